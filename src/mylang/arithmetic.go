@@ -0,0 +1,213 @@
+package main
+
+// arithmetic.go has the number operations. They are shared by the VM and
+// the constant folding in optimizer.go so both give the same results.
+// Integers stay integers, and if either operand is float the other one
+// is converted to float. Division always gives float so that 1 / 2 is
+// 0.5, and ~/ is the integer division. Bitwise operators only take
+// integers
+
+import (
+	"errors"
+	"math"
+)
+
+var errOperandsNumbers = errors.New("Operands must be numbers.")
+var errOperandNumber = errors.New("Operand must be a number.")
+var errOperandsIntegers = errors.New("Operands must be integers.")
+var errOperandInteger = errors.New("Operand must be an integer.")
+var errNegativeShift = errors.New("Shift count must not be negative.")
+var errIntegerOverflow = errors.New("Integer overflow.")
+var errDivisionByZero = errors.New("Division by zero.")
+
+// isNumeric tells if the value is integer or float
+func isNumeric(value Value) bool {
+	return IsInt(value) || IsNumber(value)
+}
+
+// toFloat converts integer or float value to float64
+func toFloat(value Value) float64 {
+	if IsInt(value) {
+		return float64(AsInt(value))
+	}
+
+	return AsNumber(value)
+}
+
+// arithmetic calculates the result of binary operator for two numbers
+func arithmetic(op uint8, a Value, b Value) (Value, error) {
+	if isBitwise(op) && (!IsInt(a) || !IsInt(b)) {
+		return Value{}, errOperandsIntegers
+	}
+	if !isNumeric(a) || !isNumeric(b) {
+		return Value{}, errOperandsNumbers
+	}
+
+	if IsInt(a) && IsInt(b) && op != OpDivide {
+		return intArithmetic(op, AsInt(a), AsInt(b))
+	}
+
+	return floatArithmetic(op, toFloat(a), toFloat(b)), nil
+}
+
+// unaryArithmetic calculates -value or ~value
+func unaryArithmetic(op uint8, value Value) (Value, error) {
+	if op == OpBitNot {
+		if !IsInt(value) {
+			return Value{}, errOperandInteger
+		}
+		return IntVal(^AsInt(value)), nil
+	}
+
+	switch {
+	case IsInt(value):
+		if AsInt(value) == math.MinInt64 {
+			return Value{}, errIntegerOverflow
+		}
+		return IntVal(-AsInt(value)), nil
+	case IsNumber(value):
+		return NumberVal(-AsNumber(value)), nil
+	default:
+		return Value{}, errOperandNumber
+	}
+}
+
+func isBitwise(op uint8) bool {
+	switch op {
+	case OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft, OpShiftRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// intArithmetic reports overflow instead of wrapping around. Division
+// truncates toward zero and the remainder has the sign of x.
+// Bitwise operators work on the two's complement bits, so shifts
+// drop the bits that don't fit
+func intArithmetic(op uint8, x int64, y int64) (Value, error) {
+	switch op {
+	case OpGreater:
+		return BoolVal(x > y), nil
+	case OpLess:
+		return BoolVal(x < y), nil
+	case OpGreaterEqual:
+		return BoolVal(x >= y), nil
+	case OpLessEqual:
+		return BoolVal(x <= y), nil
+	case OpAdd:
+		sum := x + y
+		if (y > 0 && sum < x) || (y < 0 && sum > x) {
+			return Value{}, errIntegerOverflow
+		}
+		return IntVal(sum), nil
+	case OpSubtract:
+		difference := x - y
+		if (y > 0 && difference > x) || (y < 0 && difference < x) {
+			return Value{}, errIntegerOverflow
+		}
+		return IntVal(difference), nil
+	case OpMultiply:
+		product := x * y
+		if (x == -1 && y == math.MinInt64) || (y == -1 && x == math.MinInt64) ||
+			(x != 0 && product/x != y) {
+			return Value{}, errIntegerOverflow
+		}
+		return IntVal(product), nil
+	case OpIntDivide:
+		if y == 0 {
+			return Value{}, errDivisionByZero
+		}
+		if x == math.MinInt64 && y == -1 {
+			return Value{}, errIntegerOverflow
+		}
+		return IntVal(x / y), nil
+	case OpModulo:
+		if y == 0 {
+			return Value{}, errDivisionByZero
+		}
+		if y == -1 {
+			// MinInt64 % -1 would overflow in the division
+			return IntVal(0), nil
+		}
+		return IntVal(x % y), nil
+	case OpPower:
+		return intPower(x, y)
+	case OpBitAnd:
+		return IntVal(x & y), nil
+	case OpBitOr:
+		return IntVal(x | y), nil
+	case OpBitXor:
+		return IntVal(x ^ y), nil
+	case OpShiftLeft:
+		if y < 0 {
+			return Value{}, errNegativeShift
+		}
+		return IntVal(x << uint64(y)), nil
+	case OpShiftRight:
+		if y < 0 {
+			return Value{}, errNegativeShift
+		}
+		return IntVal(x >> uint64(y)), nil
+	default:
+		return Value{}, errOperandsNumbers
+	}
+}
+
+// intPower calculates x ** y by squaring. Negative exponent gives float
+// as the result is a fraction
+func intPower(x int64, y int64) (Value, error) {
+	if y < 0 {
+		return NumberVal(math.Pow(float64(x), float64(y))), nil
+	}
+
+	result := IntVal(1)
+	base := IntVal(x)
+	for y > 0 {
+		var err error
+		if y&1 == 1 {
+			if result, err = intArithmetic(OpMultiply, AsInt(result), AsInt(base)); err != nil {
+				return Value{}, err
+			}
+		}
+		y >>= 1
+		if y > 0 {
+			if base, err = intArithmetic(OpMultiply, AsInt(base), AsInt(base)); err != nil {
+				return Value{}, err
+			}
+		}
+	}
+
+	return result, nil
+}
+
+func floatArithmetic(op uint8, x float64, y float64) Value {
+	switch op {
+	case OpGreater:
+		return BoolVal(x > y)
+	case OpLess:
+		return BoolVal(x < y)
+	case OpGreaterEqual:
+		// Same as !(x < y) so that NaN compares like OpLess, OpNot
+		return BoolVal(!(x < y))
+	case OpLessEqual:
+		// Same as !(x > y) so that NaN compares like OpGreater, OpNot
+		return BoolVal(!(x > y))
+	case OpAdd:
+		return NumberVal(x + y)
+	case OpSubtract:
+		return NumberVal(x - y)
+	case OpMultiply:
+		return NumberVal(x * y)
+	case OpDivide:
+		return NumberVal(x / y)
+	case OpIntDivide:
+		return NumberVal(math.Trunc(x / y))
+	case OpModulo:
+		return NumberVal(math.Mod(x, y))
+	case OpPower:
+		return NumberVal(math.Pow(x, y))
+	default:
+		return NilVal()
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+// ast.go defines the syntax tree built by the parser (parser.go).
+// The tree is checked by the resolver (resolver.go) and lowered to
+// bytecode by the code generator (codegen.go)
+
+// Expr is an expression node in the syntax tree
+type Expr interface {
+	// Pos returns the token where the expression starts
+	Pos() Token
+}
+
+// BinaryExpr is for a + b, a == b etc.
+type BinaryExpr struct {
+	Left     Expr
+	Operator Token
+	Right    Expr
+}
+
+// UnaryExpr is for -a and !a
+type UnaryExpr struct {
+	Operator Token
+	Operand  Expr
+}
+
+// GroupingExpr is for expression in parentheses
+type GroupingExpr struct {
+	Paren      Token
+	Expression Expr
+}
+
+// LiteralExpr is for numbers, strings, true, false and nil
+type LiteralExpr struct {
+	Token Token
+	// Value is set by the resolver
+	Value Value
+}
+
+// InterpolationExpr is for "a${x}b". Parts are the string parts
+// as LiteralExpr and the expressions between them. Empty strings
+// parts are left out
+type InterpolationExpr struct {
+	Start Token
+	Parts []Expr
+}
+
+// ListExpr is for [a, b, c]
+type ListExpr struct {
+	Bracket Token
+	Items   []Expr
+}
+
+// MapExpr is for {key: value, ...}. Keys and Values have the same length
+type MapExpr struct {
+	Brace  Token
+	Keys   []Expr
+	Values []Expr
+}
+
+// IndexExpr is for list[index] and map[key]
+type IndexExpr struct {
+	Object  Expr
+	Bracket Token
+	Index   Expr
+}
+
+// IndexSetExpr is for list[index] = value and map[key] = value.
+// Operator is '=' or compound assignment like '+='
+type IndexSetExpr struct {
+	Object   Expr
+	Bracket  Token
+	Index    Expr
+	Operator Token
+	Value    Expr
+}
+
+// IncrementExpr is for ++list[index] and list[index]-- etc.
+type IncrementExpr struct {
+	Operator Token
+	Target   *IndexExpr
+	Postfix  bool
+}
+
+// ConditionalExpr is for condition ? then : else
+type ConditionalExpr struct {
+	Condition Expr
+	Question  Token
+	Then      Expr
+	Colon     Token
+	Else      Expr
+}
+
+// InvokeExpr is for method call object.name(args)
+type InvokeExpr struct {
+	Object Expr
+	Name   Token
+	Args   []Expr
+}
+
+// CallExpr is for function call callee(args)
+type CallExpr struct {
+	Callee Expr
+	// Paren is the closing parenthesis
+	Paren Token
+	Args  []Expr
+}
+
+// GetExpr is for property object.name
+type GetExpr struct {
+	Object Expr
+	Name   Token
+}
+
+// VariableExpr is for name bound by pattern or catch, or built-in global
+type VariableExpr struct {
+	Name Token
+	// Slot is the local slot of the binding. Set by the resolver
+	Slot int
+	// Global is set by the resolver if the name isn't bound
+	Global bool
+}
+
+// MatchExpr is for match (subject) { pattern if guard => body, ... }
+type MatchExpr struct {
+	Keyword Token
+	Subject Expr
+	Arms    []*MatchArm
+	// Slot is the local slot of the subject. Set by the resolver
+	Slot int
+}
+
+// MatchArm is one arm of match. Guard is nil if the arm has no guard
+type MatchArm struct {
+	Pattern Pattern
+	Guard   Expr
+	Arrow   Token
+	Body    Expr
+}
+
+// TryExpr is for try { body } catch (name) { handler } finally
+// { cleanup }. Handler is nil without catch and Cleanup is nil without
+// finally. Name is nil if catch has no name
+type TryExpr struct {
+	Keyword Token
+	Body    Expr
+	Name    *Token
+	Handler Expr
+	Cleanup Expr
+	// Slot is the local slot of Name. Set by the resolver
+	Slot int
+}
+
+// ThrowExpr is for throw value
+type ThrowExpr struct {
+	Keyword Token
+	Value   Expr
+}
+
+// Pattern is a pattern in match arm
+type Pattern interface {
+	// Pos returns the token where the pattern starts
+	Pos() Token
+}
+
+// LiteralPattern matches value equal to number, string, true, false or
+// nil. Negative is set for -number
+type LiteralPattern struct {
+	Token    Token
+	Negative bool
+	// Value is set by the resolver
+	Value Value
+}
+
+// RangePattern matches numbers from Low to High, both included
+type RangePattern struct {
+	Low  *LiteralPattern
+	High *LiteralPattern
+}
+
+// BindingPattern matches any value and binds it to the name.
+// _ doesn't bind anything
+type BindingPattern struct {
+	Name Token
+}
+
+// ListPattern matches list that has the elements, or more with Rest
+type ListPattern struct {
+	Bracket  Token
+	Elements []Pattern
+	Rest     bool
+	// Slots has the local slot of each element, -1 for _.
+	// Set by the resolver
+	Slots []int
+}
+
+// MapPattern matches map that has the keys. Other keys are allowed
+type MapPattern struct {
+	Brace  Token
+	Keys   []*LiteralPattern
+	Values []Pattern
+	// Slots has the local slot of each value, -1 for _.
+	// Set by the resolver
+	Slots []int
+}
+
+// Pos returns the position of the left operand
+func (expr *BinaryExpr) Pos() Token {
+	return expr.Left.Pos()
+}
+
+// Pos returns the position of the operator
+func (expr *UnaryExpr) Pos() Token {
+	return expr.Operator
+}
+
+// Pos returns the position of the opening parenthesis
+func (expr *GroupingExpr) Pos() Token {
+	return expr.Paren
+}
+
+// Pos returns the position of the literal
+func (expr *LiteralExpr) Pos() Token {
+	return expr.Token
+}
+
+// Pos returns the position of the string start
+func (expr *InterpolationExpr) Pos() Token {
+	return expr.Start
+}
+
+// Pos returns the position of the opening bracket
+func (expr *ListExpr) Pos() Token {
+	return expr.Bracket
+}
+
+// Pos returns the position of the opening brace
+func (expr *MapExpr) Pos() Token {
+	return expr.Brace
+}
+
+// Pos returns the position of the indexed object
+func (expr *IndexExpr) Pos() Token {
+	return expr.Object.Pos()
+}
+
+// Pos returns the position of the indexed object
+func (expr *IndexSetExpr) Pos() Token {
+	return expr.Object.Pos()
+}
+
+// Pos returns the position of the prefix operator or the target
+func (expr *IncrementExpr) Pos() Token {
+	if expr.Postfix {
+		return expr.Target.Pos()
+	}
+	return expr.Operator
+}
+
+// Pos returns the position of the condition
+func (expr *ConditionalExpr) Pos() Token {
+	return expr.Condition.Pos()
+}
+
+// Pos returns the position of the object
+func (expr *InvokeExpr) Pos() Token {
+	return expr.Object.Pos()
+}
+
+// Pos returns the position of the callee
+func (expr *CallExpr) Pos() Token {
+	return expr.Callee.Pos()
+}
+
+// Pos returns the position of the object
+func (expr *GetExpr) Pos() Token {
+	return expr.Object.Pos()
+}
+
+// Pos returns the position of the name
+func (expr *VariableExpr) Pos() Token {
+	return expr.Name
+}
+
+// Pos returns the position of the match keyword
+func (expr *MatchExpr) Pos() Token {
+	return expr.Keyword
+}
+
+// Pos returns the position of the try keyword
+func (expr *TryExpr) Pos() Token {
+	return expr.Keyword
+}
+
+// Pos returns the position of the throw keyword
+func (expr *ThrowExpr) Pos() Token {
+	return expr.Keyword
+}
+
+// Pos returns the position of the literal
+func (pattern *LiteralPattern) Pos() Token {
+	return pattern.Token
+}
+
+// Pos returns the position of the low bound
+func (pattern *RangePattern) Pos() Token {
+	return pattern.Low.Pos()
+}
+
+// Pos returns the position of the name
+func (pattern *BindingPattern) Pos() Token {
+	return pattern.Name
+}
+
+// Pos returns the position of the opening bracket
+func (pattern *ListPattern) Pos() Token {
+	return pattern.Bracket
+}
+
+// Pos returns the position of the opening brace
+func (pattern *MapPattern) Pos() Token {
+	return pattern.Brace
+}
@@ -1,5 +1,7 @@
 package main
 
+import "math"
+
 // OpCode is for OpCode "enum"
 type OpCode uint8
 
@@ -18,6 +20,12 @@ const (
 	OpGreater uint8 = iota
 	// OpLess is for <
 	OpLess uint8 = iota
+	// OpNotEqual is for !=
+	OpNotEqual uint8 = iota
+	// OpGreaterEqual is for >=
+	OpGreaterEqual uint8 = iota
+	// OpLessEqual is for <=
+	OpLessEqual uint8 = iota
 	// OpAdd is add operand
 	OpAdd uint8 = iota
 	// OpSubtract is subtract operand
@@ -26,30 +34,149 @@ const (
 	OpMultiply uint8 = iota
 	// OpDivide is divide operand
 	OpDivide uint8 = iota
+	// OpIntDivide is integer division that truncates toward zero
+	OpIntDivide uint8 = iota
+	// OpModulo is remainder of division
+	OpModulo uint8 = iota
+	// OpPower is exponentiation
+	OpPower uint8 = iota
+	// OpBitAnd is bitwise and of integers
+	OpBitAnd uint8 = iota
+	// OpBitOr is bitwise or of integers
+	OpBitOr uint8 = iota
+	// OpBitXor is bitwise exclusive or of integers
+	OpBitXor uint8 = iota
+	// OpShiftLeft shifts integer left
+	OpShiftLeft uint8 = iota
+	// OpShiftRight shifts integer right keeping the sign
+	OpShiftRight uint8 = iota
 	// OpNot is code for ! (boolean thing)
 	OpNot uint8 = iota
 	// OpNegate is negate operand
 	OpNegate uint8 = iota
+	// OpBitNot inverts the bits of integer
+	OpBitNot uint8 = iota
+	// OpBuildString converts the top operand count values to strings
+	// and joins them
+	OpBuildString uint8 = iota
+	// OpBuildList creates list from the top operand count values
+	OpBuildList uint8 = iota
+	// OpBuildMap creates map from the top operand count key and value pairs
+	OpBuildMap uint8 = iota
+	// OpIndexGet is for list[index] and map[key]
+	OpIndexGet uint8 = iota
+	// OpIndexSet is for list[index] = value and map[key] = value
+	OpIndexSet uint8 = iota
+	// OpIndexIncrement adds 1 to list[index] or map[key]. The operand
+	// has IncrementFlags
+	OpIndexIncrement uint8 = iota
+	// OpInvoke calls method that has the name of constant operand with
+	// the argument count in second operand
+	OpInvoke uint8 = iota
+	// OpCall calls function with the argument count in operand. The
+	// function is below the arguments
+	OpCall uint8 = iota
+	// OpPop removes the top value
+	OpPop uint8 = iota
+	// OpDup2 duplicates the top two values
+	OpDup2 uint8 = iota
+	// OpJump jumps forward by the two byte operand
+	OpJump uint8 = iota
+	// OpJumpIfFalse jumps forward by the two byte operand if the top
+	// value is falsey. The value is left on the stack
+	OpJumpIfFalse uint8 = iota
+	// OpGetLocal pushes the value of the local slot in operand
+	OpGetLocal uint8 = iota
+	// OpDefineLocal pops value to the local slot in operand
+	OpDefineLocal uint8 = iota
+	// OpMatchList tells if the popped value is list that has the length
+	// in operand. With MatchListRest flag the list can be longer
+	OpMatchList uint8 = iota
+	// OpMatchMap tells if the popped value is map
+	OpMatchMap uint8 = iota
+	// OpInRange tells if low <= value <= high for the popped value, low
+	// and high. Values that aren't numbers are not in range
+	OpInRange uint8 = iota
+	// OpJumpTable pops integer and jumps to the address in the table that
+	// follows. Operands are the constant of the lowest value, the table
+	// size and two byte addresses: the default and one per value
+	OpJumpTable uint8 = iota
+	// OpNoMatch reports that no match arm matched the popped value
+	OpNoMatch uint8 = iota
+	// OpGetGlobal pushes the built-in global named by the constant
+	OpGetGlobal uint8 = iota
+	// OpGetProperty replaces the module with its constant named by
+	// the constant
+	OpGetProperty uint8 = iota
+	// OpTry pushes exception handler that continues from the jump target
+	// with the exception on the stack. The second jump is to the finally
+	// block that exit runs, or 0 if the try has no finally
+	OpTry uint8 = iota
+	// OpEndTry pops the innermost exception handler
+	OpEndTry uint8 = iota
+	// OpThrow throws the popped value
+	OpThrow uint8 = iota
+	// OpRethrow throws the popped value again with its original trace
+	OpRethrow uint8 = iota
+	// OpEndFinally pops flag that tells if the finally block was run for
+	// exception. If so, the exception below it is thrown again
+	OpEndFinally uint8 = iota
 	// OpReturn is code for return
 	OpReturn uint8 = iota
+	// OpExtendList appends the top operand count values to the list
+	// under them
+	OpExtendList uint8 = iota
+	// OpExtendMap sets the top operand count key and value pairs to the
+	// map under them
+	OpExtendMap uint8 = iota
+)
+
+// MatchListRest is the OpMatchList operand flag for [a, ..] patterns
+const MatchListRest uint8 = 0x80
+
+// IncrementFlags are the operand bits of OpIndexIncrement
+const (
+	// IncrementDecrement subtracts 1 instead of adding it
+	IncrementDecrement uint8 = 1 << iota
+	// IncrementPostfix leaves the old value on the stack instead of the new
+	IncrementPostfix
 )
 
+// ChunkVersion is the version of the bytecode format. It must be
+// changed when opcodes or their operands change, so that the VM
+// rejects .glb files compiled for the old format
+const ChunkVersion = 6
+
+// MaxConstants is the size of the constant table of a chunk
+const MaxConstants = math.MaxInt8 + 1
+
 // Chunk contains the program code in bytecodes
 type Chunk struct {
-	Count     int
-	Capacity  int
-	Code      []uint8
-	Lines     []int
+	// Version is ChunkVersion of the compiler that wrote the chunk
+	Version  int
+	Count    int
+	Capacity int
+	Code     []uint8
+	Lines    []int
+	// Columns has the column of the token of each byte like Lines has
+	// the line. Runtime errors report both
+	Columns   []int
 	Constants ValueArray
+	// constantIndex finds the constants that have a key. It's built
+	// when the first constant is added, so decoded chunks get one too
+	constantIndex map[MapKey]int
 }
 
 // InitChunk sets the initial values
 func (chunk *Chunk) InitChunk() {
+	chunk.Version = ChunkVersion
 	chunk.Count = 0
 	chunk.Capacity = 0
 	chunk.Code = nil
 	chunk.Lines = nil
+	chunk.Columns = nil
 	chunk.Constants = ValueArray{}
+	chunk.constantIndex = nil
 }
 
 // FreeChunk just initializes the object and lets the golang deal with memory
@@ -58,7 +185,7 @@ func (chunk *Chunk) FreeChunk() {
 }
 
 // WriteChunk writes instruction to chunk struct
-func (chunk *Chunk) WriteChunk(_byte uint8, line int) {
+func (chunk *Chunk) WriteChunk(_byte uint8, line int, column int) {
 	if chunk.Capacity < chunk.Count+1 {
 		oldCapacity := chunk.Capacity
 		chunk.Capacity = GrowCapacity(oldCapacity)
@@ -67,15 +194,62 @@ func (chunk *Chunk) WriteChunk(_byte uint8, line int) {
 
 	chunk.Code[chunk.Count] = _byte
 	chunk.Lines[chunk.Count] = line
+	chunk.Columns[chunk.Count] = column
 	chunk.Count++
 }
 
 // AddConstant adds constant to chunk ValueArray
+// If the same constant is already in the array, its index is reused
 func (chunk *Chunk) AddConstant(value Value) int {
+	if chunk.constantIndex == nil {
+		chunk.constantIndex = map[MapKey]int{}
+		for i := chunk.Constants.Count - 1; i >= 0; i-- {
+			if key, ok := constantKey(chunk.Constants.Values[i]); ok {
+				chunk.constantIndex[key] = i
+			}
+		}
+	}
+
+	key, ok := constantKey(value)
+	if !ok {
+		// Values without key are compared one by one
+		for i := 0; i < chunk.Constants.Count; i++ {
+			if SameConstant(chunk.Constants.Values[i], value) {
+				return i
+			}
+		}
+		chunk.Constants.WriteValueArray(value)
+		return chunk.Constants.Count - 1
+	}
+
+	if index, found := chunk.constantIndex[key]; found {
+		return index
+	}
 	chunk.Constants.WriteValueArray(value)
+	chunk.constantIndex[key] = chunk.Constants.Count - 1
 	return chunk.Constants.Count - 1
 }
 
+// constantKey returns the key of constant that is the same for the
+// values that SameConstant tells can share a slot. Floats use their bit
+// pattern. Returns false for values without key
+func constantKey(value Value) (MapKey, bool) {
+	switch value.Type {
+	case ValBool:
+		return MapKey{Type: ValBool, Bool: AsBool(value)}, true
+	case ValNil:
+		return MapKey{Type: ValNil}, true
+	case ValInt:
+		return MapKey{Type: ValInt, Int: AsInt(value)}, true
+	case ValNumber:
+		return MapKey{Type: ValNumber, Int: int64(math.Float64bits(AsNumber(value)))}, true
+	case ValString:
+		return MapKey{Type: ValString, Chars: AsString(value)}, true
+	default:
+		return MapKey{}, false
+	}
+}
+
 // Reallocate the Chunk
 func (chunk *Chunk) Reallocate(oldSize int) {
 	// Resize the Code
@@ -83,8 +257,12 @@ func (chunk *Chunk) Reallocate(oldSize int) {
 	copy(t, chunk.Code)
 	chunk.Code = t
 
-	// Resize the lines
+	// Resize the lines and columns
 	t1 := make([]int, chunk.Capacity)
 	copy(t1, chunk.Lines)
 	chunk.Lines = t1
+
+	t2 := make([]int, chunk.Capacity)
+	copy(t2, chunk.Columns)
+	chunk.Columns = t2
 }
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestAddConstantReusesSameConstants(t *testing.T) {
+	chunk := Chunk{}
+	chunk.InitChunk()
+
+	list := ListVal([]Value{IntVal(1)})
+	tests := []struct {
+		Value Value
+		Index int
+	}{
+		{IntVal(0), 0},
+		{NumberVal(0), 1},
+		{NumberVal(math.Copysign(0, -1)), 2},
+		{IntVal(0), 0},
+		{NumberVal(0), 1},
+		{StringVal("a"), 3},
+		{NumberVal(math.NaN()), 4},
+		{NumberVal(math.NaN()), 4},
+		{BoolVal(false), 5},
+		{NilVal(), 6},
+		{list, 7},
+		{ListVal([]Value{IntVal(1)}), 7},
+		{StringVal("a"), 3},
+		{BoolVal(false), 5},
+	}
+
+	for _, test := range tests {
+		if index := chunk.AddConstant(test.Value); index != test.Index {
+			t.Errorf("AddConstant(%s) returned %d, want %d", FormatValue(test.Value), index, test.Index)
+		}
+	}
+}
+
+func TestAddConstantIndexesDecodedChunk(t *testing.T) {
+	chunk := Chunk{}
+	chunk.Constants.WriteValueArray(StringVal("a"))
+	chunk.Constants.WriteValueArray(IntVal(2))
+
+	if index := chunk.AddConstant(IntVal(2)); index != 1 {
+		t.Errorf("AddConstant(2) returned %d, want 1", index)
+	}
+	if index := chunk.AddConstant(IntVal(3)); index != 2 {
+		t.Errorf("AddConstant(3) returned %d, want 2", index)
+	}
+}
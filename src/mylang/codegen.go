@@ -0,0 +1,348 @@
+package main
+
+// codegen.go lowers resolved syntax tree to bytecode in the compiling chunk.
+// Emits the same code as the single pass compiler in compiler.go
+
+// GenerateCode writes the bytecode for the expression to the compiling chunk
+func GenerateCode(expr Expr) {
+	generateExpr(expr)
+}
+
+func genByte(_byte uint8, token Token) {
+	currentChunk().WriteChunk(_byte, token.Line, token.Column)
+}
+
+func genBytes(byte1, byte2 uint8, token Token) {
+	genByte(byte1, token)
+	genByte(byte2, token)
+}
+
+func generateExpr(expr Expr) {
+	switch expr := expr.(type) {
+	case *BinaryExpr:
+		generateBinary(expr)
+	case *UnaryExpr:
+		generateUnary(expr)
+	case *GroupingExpr:
+		generateExpr(expr.Expression)
+	case *InterpolationExpr:
+		for _, part := range expr.Parts {
+			generateExpr(part)
+		}
+		genBytes(OpBuildString, uint8(len(expr.Parts)), expr.Start)
+	case *LiteralExpr:
+		generateLiteral(expr)
+	case *ListExpr:
+		batches := newListBatches(expr.Bracket)
+		for _, item := range expr.Items {
+			generateExpr(item)
+			batches.add()
+		}
+		batches.end()
+	case *MapExpr:
+		batches := newMapBatches(expr.Brace)
+		for i := range expr.Keys {
+			generateExpr(expr.Keys[i])
+			generateExpr(expr.Values[i])
+			batches.add()
+		}
+		batches.end()
+	case *IndexExpr:
+		generateExpr(expr.Object)
+		generateExpr(expr.Index)
+		genByte(OpIndexGet, expr.Bracket)
+	case *IndexSetExpr:
+		generateIndexSet(expr)
+	case *IncrementExpr:
+		generateIncrement(expr)
+	case *ConditionalExpr:
+		generateConditional(expr)
+	case *InvokeExpr:
+		generateInvoke(expr)
+	case *CallExpr:
+		generateExpr(expr.Callee)
+		for _, arg := range expr.Args {
+			generateExpr(arg)
+		}
+		genBytes(OpCall, uint8(len(expr.Args)), expr.Paren)
+	case *GetExpr:
+		generateExpr(expr.Object)
+		genBytes(OpGetProperty, makeConstantAt(StringVal(expr.Name.Value), &expr.Name), expr.Name)
+	case *VariableExpr:
+		generateVariable(expr)
+	case *MatchExpr:
+		generateMatch(expr)
+	case *TryExpr:
+		generateTry(expr)
+	case *ThrowExpr:
+		generateExpr(expr.Value)
+		genByte(OpThrow, expr.Keyword)
+	}
+}
+
+func generateVariable(expr *VariableExpr) {
+	if expr.Global {
+		genBytes(OpGetGlobal, makeConstantAt(StringVal(expr.Name.Value), &expr.Name), expr.Name)
+		return
+	}
+
+	genBytes(OpGetLocal, uint8(expr.Slot), expr.Name)
+}
+
+func generateBinary(expr *BinaryExpr) {
+	generateExpr(expr.Left)
+	generateExpr(expr.Right)
+
+	operator := expr.Operator
+	switch operator.Type {
+	case TokenBangEqual:
+		genBytes(OpEqual, OpNot, operator)
+	case TokenEqualEqual:
+		genByte(OpEqual, operator)
+	case TokenGreater:
+		genByte(OpGreater, operator)
+	case TokenGreaterEqual:
+		genBytes(OpLess, OpNot, operator)
+	case TokenLess:
+		genByte(OpLess, operator)
+	case TokenLessEqual:
+		genBytes(OpGreater, OpNot, operator)
+	case TokenPlus:
+		genByte(OpAdd, operator)
+	case TokenMinus:
+		genByte(OpSubtract, operator)
+	case TokenStar:
+		genByte(OpMultiply, operator)
+	case TokenSlash:
+		genByte(OpDivide, operator)
+	case TokenTildeSlash:
+		genByte(OpIntDivide, operator)
+	case TokenPercent:
+		genByte(OpModulo, operator)
+	case TokenStarStar:
+		genByte(OpPower, operator)
+	case TokenAmpersand:
+		genByte(OpBitAnd, operator)
+	case TokenPipe:
+		genByte(OpBitOr, operator)
+	case TokenCaret:
+		genByte(OpBitXor, operator)
+	case TokenLessLess:
+		genByte(OpShiftLeft, operator)
+	case TokenGreaterGreater:
+		genByte(OpShiftRight, operator)
+	}
+}
+
+func generateUnary(expr *UnaryExpr) {
+	generateExpr(expr.Operand)
+
+	switch expr.Operator.Type {
+	case TokenBang:
+		genByte(OpNot, expr.Operator)
+	case TokenMinus:
+		genByte(OpNegate, expr.Operator)
+	case TokenTilde:
+		genByte(OpBitNot, expr.Operator)
+	}
+}
+
+func generateIndexSet(expr *IndexSetExpr) {
+	generateExpr(expr.Object)
+	generateExpr(expr.Index)
+
+	if expr.Operator.Type == TokenEqual {
+		generateExpr(expr.Value)
+		genByte(OpIndexSet, expr.Operator)
+		return
+	}
+
+	// list[i] += v evaluates list and i once
+	genBytes(OpDup2, OpIndexGet, expr.Operator)
+	generateExpr(expr.Value)
+	genBytes(compoundOperators[expr.Operator.Type], OpIndexSet, expr.Operator)
+}
+
+func generateIncrement(expr *IncrementExpr) {
+	generateExpr(expr.Target.Object)
+	generateExpr(expr.Target.Index)
+
+	var flags uint8
+	if expr.Operator.Type == TokenMinusMinus {
+		flags |= IncrementDecrement
+	}
+	if expr.Postfix {
+		flags |= IncrementPostfix
+	}
+	genBytes(OpIndexIncrement, flags, expr.Operator)
+}
+
+func generateConditional(expr *ConditionalExpr) {
+	generateExpr(expr.Condition)
+	elseJump := genJump(OpJumpIfFalse, expr.Question)
+	genByte(OpPop, expr.Question)
+	generateExpr(expr.Then)
+
+	endJump := genJump(OpJump, expr.Colon)
+	patchJump(elseJump, &expr.Question)
+	genByte(OpPop, expr.Colon)
+	generateExpr(expr.Else)
+	patchJump(endJump, &expr.Question)
+}
+
+func generateMatch(expr *MatchExpr) {
+	generateExpr(expr.Subject)
+	genBytes(OpDefineLocal, uint8(expr.Slot), expr.Keyword)
+	dispatch := genJump(OpJump, expr.Keyword)
+
+	arms := []matchArm{}
+	endJumps := []int{}
+	for _, arm := range expr.Arms {
+		compiled := matchArm{TestStart: currentChunk().Count}
+		fails := generatePattern(arm.Pattern, expr.Slot, []int{})
+		if literal, ok := arm.Pattern.(*LiteralPattern); ok && arm.Guard == nil && IsInt(literal.Value) {
+			compiled.IsInt = true
+			compiled.Int = AsInt(literal.Value)
+		}
+
+		if arm.Guard != nil {
+			generateExpr(arm.Guard)
+			fails = append(fails, emitTest(arm.Arrow))
+		}
+
+		compiled.BodyStart = currentChunk().Count
+		generateExpr(arm.Body)
+		endJumps = append(endJumps, genJump(OpJump, arm.Arrow))
+		endArm(fails, arm.Arrow)
+		arms = append(arms, compiled)
+	}
+
+	endMatch(expr.Keyword, expr.Slot, arms, dispatch, endJumps)
+}
+
+func generateTry(expr *TryExpr) {
+	keyword := expr.Keyword
+	handler := genTry(keyword)
+	tries := []int{handler}
+	generateExpr(expr.Body)
+	genByte(OpEndTry, keyword)
+	doneJumps := []int{genJump(OpJump, keyword)}
+	patchJump(handler, &keyword)
+
+	if expr.Handler != nil {
+		if expr.Name != nil {
+			genBytes(OpDefineLocal, uint8(expr.Slot), keyword)
+		} else {
+			genByte(OpPop, keyword)
+		}
+
+		// Exceptions from the handler go to finally
+		handler = genTry(keyword)
+		tries = append(tries, handler)
+		generateExpr(expr.Handler)
+		genByte(OpEndTry, keyword)
+		doneJumps = append(doneJumps, genJump(OpJump, keyword))
+		patchJump(handler, &keyword)
+	}
+
+	if expr.Cleanup == nil {
+		genByte(OpRethrow, keyword)
+		for _, jump := range doneJumps {
+			patchJump(jump, &keyword)
+		}
+		return
+	}
+
+	// The flag tells OpEndFinally if cleanup was run for exception
+	patchFinally(tries, &keyword)
+	genByte(OpTrue, keyword)
+	exceptionJump := genJump(OpJump, keyword)
+	for _, jump := range doneJumps {
+		patchJump(jump, &keyword)
+	}
+	genByte(OpFalse, keyword)
+	patchJump(exceptionJump, &keyword)
+
+	generateExpr(expr.Cleanup)
+	genBytes(OpPop, OpEndFinally, keyword)
+}
+
+// generatePattern emits the tests of pattern for the value in slot.
+// Returns fails with the jumps of the failed tests added
+func generatePattern(pattern Pattern, slot int, fails []int) []int {
+	switch pattern := pattern.(type) {
+	case *LiteralPattern:
+		fails = append(fails, emitLiteralTest(slot, pattern.Value, pattern.Token))
+	case *RangePattern:
+		fails = append(fails, emitRangeTest(slot, pattern.Low.Value, pattern.High.Value, pattern.Low.Token))
+	case *ListPattern:
+		fails = append(fails, emitListTest(slot, len(pattern.Elements), pattern.Rest, pattern.Bracket))
+		for i, element := range pattern.Elements {
+			if pattern.Slots[i] >= 0 {
+				emitLoad(slot, IntVal(int64(i)), pattern.Slots[i], pattern.Bracket)
+				fails = generatePattern(element, pattern.Slots[i], fails)
+			}
+		}
+	case *MapPattern:
+		fails = append(fails, emitMapTest(slot, pattern.Brace))
+		for i, key := range pattern.Keys {
+			fails = append(fails, emitKeyTest(slot, key.Value, key.Token))
+			if pattern.Slots[i] >= 0 {
+				emitLoad(slot, key.Value, pattern.Slots[i], key.Token)
+				fails = generatePattern(pattern.Values[i], pattern.Slots[i], fails)
+			}
+		}
+	}
+
+	return fails
+}
+
+// genJump writes jump with placeholder offset to be set with patchJump
+func genJump(instruction uint8, token Token) int {
+	genByte(instruction, token)
+	genBytes(0xff, 0xff, token)
+	return currentChunk().Count - 2
+}
+
+// genTry emits OpTry and returns the offset of its handler jump. The
+// finally jump after it is left 0 unless patchFinally sets it
+func genTry(token Token) int {
+	handler := genJump(OpTry, token)
+	genBytes(0, 0, token)
+	return handler
+}
+
+// patchFinally sets the finally jumps of the OpTry instructions of one
+// try expression to the end of the chunk
+func patchFinally(tries []int, token *Token) {
+	for _, handler := range tries {
+		patchJump(handler+2, token)
+	}
+}
+
+func generateInvoke(expr *InvokeExpr) {
+	generateExpr(expr.Object)
+
+	// Name constant is added before the arguments like in the single pass
+	// compiler so both have the same constant table
+	name := makeConstantAt(StringVal(expr.Name.Value), &expr.Name)
+	for _, arg := range expr.Args {
+		generateExpr(arg)
+	}
+
+	genBytes(OpInvoke, name, expr.Name)
+	genByte(uint8(len(expr.Args)), expr.Name)
+}
+
+func generateLiteral(expr *LiteralExpr) {
+	switch expr.Token.Type {
+	case TokenFalse:
+		genByte(OpFalse, expr.Token)
+	case TokenNil:
+		genByte(OpNil, expr.Token)
+	case TokenTrue:
+		genByte(OpTrue, expr.Token)
+	default:
+		genBytes(OpConstant, makeConstantAt(expr.Value, &expr.Token), expr.Token)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// pipelinePrograms cover the syntax of both compilers
+var pipelinePrograms = []program{
+	{"-2 ** 2", "-4\n"},
+	{"1 + (2 - 3) * -4", "5\n"},
+	{"r\"raw\\n\" + \"\"\"\n  multi\n  line\"\"\"", "raw\\nmulti\nline\n"},
+	{"[1, 2, 3][-1]", "3\n"},
+	{"{\"a\": [1, 2]}[\"a\"].len()", "2\n"},
+	{"match ([1]) { l => [l[0] += 2, l[0]++, --l[0], l] }", "[3, 3, 3, [3]]\n"},
+	// -- is decrement only next to index
+	{"[--1, 5--2 * 3, 2--3 ** 2]", "[1, 11, 11]\n"},
+	{"match ([5]) { l => [--(l[0]), 1--l[0], l] }", "[5, 6, [5]]\n"},
+	{"1 < 2 ? \"yes\" : \"no\"", "yes\n"},
+	{"match ({\"k\": 1}) { {\"k\": v} if v > 0 => v, _ => 0 }", "1\n"},
+	{"try { try { throw \"a\" } finally { 1 } } catch (e) { e }", "a\n"},
+	{"try { throw 0 } catch { try { 1 } finally { 2 } } finally { 3 }", "1\n"},
+	{"[1, 2].slice(1)", "[2]\n"},
+	{"match ([1, 2]) { l => [l.insert(-1, 3), l.insert(2, 4), l.insert(-4, 0), l][3] }", "[0, 1, 3, 4, 2]\n"},
+	{"try { [1].insert(-3, 0) } catch (e) { e[\"message\"] }", "List index out of range.\n"},
+	{"[1, 2, [" + strings.Repeat("0, ", 254) + "0]][2].len()", "255\n"},
+	// The unfinished batches of the nested lists don't fit on the stack
+	{strings.Repeat("["+strings.Repeat("0, ", 63), 5) + "0" + strings.Repeat("]", 5), "Stack overflow.\n[line 1:774] in script\n"},
+	{"try { " + strings.Repeat("["+strings.Repeat("0, ", 63), 5) + "0" + strings.Repeat("]", 5) + " } catch (e) { e[\"message\"] }", "Stack overflow.\n"},
+	{"[1, 2, 3, {" + strings.Repeat("0: 0, ", 126) + "0: 1}]", "[1, 2, 3, {0: 1}]\n"},
+	{strings.Repeat("{"+strings.Repeat("0: 0, ", 31)+"1: ", 5) + "0" + strings.Repeat("}", 5), "Stack overflow.\n[line 1:774] in script\n"},
+}
+
+// compileChunk compiles the source with the current compiler options
+func compileChunk(t *testing.T, source string) Chunk {
+	saved := DebugPrintCode
+	DebugPrintCode = false
+	defer func() { DebugPrintCode = saved }()
+
+	chunk := Chunk{}
+	chunk.InitChunk()
+	if !Compile(strings.NewReader(source), &chunk) {
+		t.Fatalf("%s didn't compile", source)
+	}
+	return chunk
+}
+
+// compileSinglePassChunk compiles the source with the single pass
+// compiler
+func compileSinglePassChunk(t *testing.T, source string) Chunk {
+	SinglePassCompiler = true
+	defer func() { SinglePassCompiler = false }()
+
+	return compileChunk(t, source)
+}
+
+func TestPipelinesGiveSameBytecode(t *testing.T) {
+	for _, p := range append(optimizerPrograms, pipelinePrograms...) {
+		for _, level := range []int{0, 1} {
+			OptimizationLevel = level
+			tree := compileChunk(t, p.Source)
+			single := compileSinglePassChunk(t, p.Source)
+
+			if !bytes.Equal(tree.Code[:tree.Count], single.Code[:single.Count]) {
+				t.Errorf("%s at -O%d compiles to different code", p.Source, level)
+			} else if !reflect.DeepEqual(tree.Lines[:tree.Count], single.Lines[:single.Count]) ||
+				!reflect.DeepEqual(tree.Columns[:tree.Count], single.Columns[:single.Count]) {
+				t.Errorf("%s at -O%d compiles to code at different positions", p.Source, level)
+			}
+			treeConstants := tree.Constants.Values[:tree.Constants.Count]
+			singleConstants := single.Constants.Values[:single.Constants.Count]
+			if FormatValue(ListVal(treeConstants)) != FormatValue(ListVal(singleConstants)) {
+				t.Errorf("%s at -O%d has different constants", p.Source, level)
+			}
+		}
+	}
+	OptimizationLevel = 1
+}
+
+func TestPipelinesGiveSameOutput(t *testing.T) {
+	checkPipelines(t, pipelinePrograms)
+}
+
+// checkPipelines runs the programs with both compilers
+func checkPipelines(t *testing.T, programs []program) {
+	for _, p := range programs {
+		tree := runProgram(t, p.Source)
+
+		SinglePassCompiler = true
+		single := runProgram(t, p.Source)
+		SinglePassCompiler = false
+
+		if tree != p.Output {
+			t.Errorf("%s printed %q, want %q", p.Source, tree, p.Output)
+		}
+		if single != tree {
+			t.Errorf("%s printed %q with -single-pass but %q", p.Source, single, tree)
+		}
+	}
+}
+
+// compileErrors compiles the source that has errors. Returns the errors
+// that the compiler printed
+func compileErrors(t *testing.T, source string, singlePass bool) string {
+	SinglePassCompiler = singlePass
+	defer func() { SinglePassCompiler = false }()
+
+	return captureOutput(t, func() {
+		chunk := Chunk{}
+		chunk.InitChunk()
+		if Compile(strings.NewReader(source), &chunk) {
+			t.Errorf("%s compiled", source)
+		}
+	})
+}
+
+// errorProgram is a program that doesn't compile and the errors it
+// prints. SinglePass is set when the single pass compiler prints
+// different errors
+type errorProgram struct {
+	Source     string
+	Output     string
+	SinglePass string
+}
+
+// checkCompileErrors compiles the programs with both compilers
+func checkCompileErrors(t *testing.T, programs []errorProgram) {
+	for _, p := range programs {
+		if output := compileErrors(t, p.Source, false); output != p.Output {
+			t.Errorf("%s printed %q, want %q", p.Source, output, p.Output)
+		}
+
+		want := p.Output
+		if p.SinglePass != "" {
+			want = p.SinglePass
+		}
+		if output := compileErrors(t, p.Source, true); output != want {
+			t.Errorf("%s printed %q with -single-pass, want %q", p.Source, output, want)
+		}
+	}
+}
+
+// TestRuntimeErrorColumns checks that runtime errors point at the
+// operator, bracket or name of the failed instruction
+func TestRuntimeErrorColumns(t *testing.T) {
+	programs := []program{
+		{"1 +\n  \"x\"", "Operands must be numbers.\n[line 1:3] in script\n"},
+		{"1 + -\"x\"", "Operand must be a number.\n[line 1:5] in script\n"},
+		{"match (1) { l => [0,\n  l[0]] }", "Only lists and maps can be indexed.\n[line 2:4] in script\n"},
+		{"match ([1]) { l => l[\"a\"] = 2 }", "List index must be an integer.\n[line 1:27] in script\n"},
+		{"match ([1]) { l => l[0] += \"a\" }", "Operands must be numbers.\n[line 1:25] in script\n"},
+		{"match ([\"a\"]) { l => l[0]++ }", "Operand must be a number.\n[line 1:26] in script\n"},
+		{"match (\"a\") { s => 1 - --s }", "Operand must be a number.\n[line 1:25] in script\n"},
+		{"match (\"a\") { s => 1--s }", "Operand must be a number.\n[line 1:22] in script\n"},
+		{"\"a\".nope(\n  1)", "Undefined method 'nope'.\n[line 1:5] in script\n"},
+		{"\"a${1 + \"b\"}c${2}\"", "Operands must be numbers.\n[line 1:7] in script\n"},
+	}
+	checkPipelines(t, programs)
+}
@@ -2,9 +2,9 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"math"
 	"os"
-	"strconv"
 )
 
 // Parser keeps track of Tokens we are turning into bytecode
@@ -13,6 +13,13 @@ type Parser struct {
 	Previous  Token
 	HadError  bool
 	PanicMode bool
+	// CanAssign tells if the expression being parsed can be followed
+	// by '='. Set before each prefix and infix rule is called
+	CanAssign bool
+	// Increment is the prefix ++ or -- waiting for its target. It's
+	// passed to each infix rule of the operand and the last index
+	// expression applies it
+	Increment *Token
 }
 
 // Precedence is for tracking what operatios are emited first
@@ -22,8 +29,10 @@ type Precedence int
 const (
 	// PrecNone is is the last thing emited
 	PrecNone Precedence = iota
-	// PrecAssignment is for =
+	// PrecAssignment is for = += -= *= /= %=
 	PrecAssignment Precedence = iota
+	// PrecTernary is for ?:
+	PrecTernary Precedence = iota
 	// PrecOr is for or
 	PrecOr Precedence = iota
 	// PrecAnd is for and
@@ -32,12 +41,22 @@ const (
 	PrecEquality Precedence = iota
 	// PrecComparison is for < > <= >=
 	PrecComparison Precedence = iota
+	// PrecBitOr is for |
+	PrecBitOr Precedence = iota
+	// PrecBitXor is for ^
+	PrecBitXor Precedence = iota
+	// PrecBitAnd is for &
+	PrecBitAnd Precedence = iota
+	// PrecShift is for << >>
+	PrecShift Precedence = iota
 	// PrecTerm is for + -
 	PrecTerm Precedence = iota
-	// PrecFactor is for * /
+	// PrecFactor is for * / ~/ %
 	PrecFactor Precedence = iota
-	// PrecUnary is for ! - +
+	// PrecUnary is for ! - ~
 	PrecUnary Precedence = iota
+	// PrecPower is for **. Higher than unary so -2 ** 2 is -(2 ** 2)
+	PrecPower Precedence = iota
 	// PrecCall is for . () []
 	PrecCall Precedence = iota
 	// PrecPrimary is going to be defined later
@@ -74,7 +93,7 @@ func errorAt(token *Token, message string) {
 
 	parser.PanicMode = true
 
-	fmt.Fprintf(os.Stderr, "[line %d] Error", token.Line)
+	fmt.Fprintf(os.Stderr, "[line %d:%d] Error", token.Line, token.Column)
 
 	if token.Type == TokenEOF {
 		fmt.Fprintf(os.Stderr, " at end")
@@ -109,6 +128,16 @@ func advanceParser() {
 	}
 }
 
+// matchToken consumes the current token if it has the type
+func matchToken(_type TokenType) bool {
+	if parser.Current.Type != _type {
+		return false
+	}
+
+	advanceParser()
+	return true
+}
+
 func consumeToken(_type TokenType, message string) {
 	if parser.Current.Type == _type {
 		advanceParser()
@@ -119,7 +148,7 @@ func consumeToken(_type TokenType, message string) {
 }
 
 func emitByte(_byte uint8) {
-	currentChunk().WriteChunk(_byte, parser.Previous.Line)
+	currentChunk().WriteChunk(_byte, parser.Previous.Line, parser.Previous.Column)
 }
 
 func emitBytes(byte1, byte2 uint8) {
@@ -127,14 +156,39 @@ func emitBytes(byte1, byte2 uint8) {
 	emitByte(byte2)
 }
 
+// emitJump writes jump instruction with placeholder offset and returns
+// the position of the offset for patchJump
+func emitJump(instruction uint8) int {
+	emitByte(instruction)
+	emitBytes(0xff, 0xff)
+	return currentChunk().Count - 2
+}
+
+// patchJump sets the jump at offset to jump to the end of the chunk
+func patchJump(offset int, token *Token) {
+	// -2 for the jump offset itself
+	jump := currentChunk().Count - offset - 2
+	if jump > math.MaxUint16 {
+		errorAt(token, "Too much code to jump over")
+	}
+
+	currentChunk().Code[offset] = uint8(jump >> 8)
+	currentChunk().Code[offset+1] = uint8(jump)
+}
+
 func emitReturn() {
 	emitByte(OpReturn)
 }
 
 func makeConstant(value Value) uint8 {
+	return makeConstantAt(value, &parser.Previous)
+}
+
+// makeConstantAt adds the constant and reports errors at token
+func makeConstantAt(value Value, token *Token) uint8 {
 	constant := currentChunk().AddConstant(value)
-	if constant > math.MaxInt8 {
-		errorAtPrev("Too many constant in one chunk")
+	if constant >= MaxConstants {
+		errorAt(token, "Too many constant in one chunk")
 		return 0
 	}
 
@@ -147,50 +201,84 @@ func emitConstant(value Value) {
 
 func endCompiler() {
 	emitReturn()
+	if OptimizationLevel > 0 && !parser.HadError {
+		currentChunk().Optimize()
+	}
 	if DebugPrintCode && !parser.HadError {
 		currentChunk().DisassembleChunk("code")
 	}
 }
 
 func parseBinary() {
-	// Remember the operator
-	operatorType := parser.Previous.Type
+	// Remember the operator. Its instruction is at the operator, so
+	// runtime errors point at it
+	operator := parser.Previous
+	operatorType := operator.Type
 
-	// Compile the right operand
+	// Compile the right operand. ** is right associative so
+	// 2 ** 3 ** 2 is 2 ** (3 ** 2)
 	rule := getRule(operatorType)
-	parsePrecedence(rule.Precedence + 1)
+	if operatorType == TokenStarStar {
+		parsePrecedence(rule.Precedence)
+	} else {
+		parsePrecedence(rule.Precedence + 1)
+	}
 
 	// Emit the operator instruction
 	switch operatorType {
 	case TokenBangEqual:
-		emitBytes(OpEqual, OpNot)
+		genBytes(OpEqual, OpNot, operator)
 		break
 	case TokenEqualEqual:
-		emitByte(OpEqual)
+		genByte(OpEqual, operator)
 		break
 	case TokenGreater:
-		emitByte(OpGreater)
+		genByte(OpGreater, operator)
 		break
 	case TokenGreaterEqual:
-		emitBytes(OpLess, OpNot)
+		genBytes(OpLess, OpNot, operator)
 		break
 	case TokenLess:
-		emitByte(OpLess)
+		genByte(OpLess, operator)
 		break
 	case TokenLessEqual:
-		emitBytes(OpGreater, OpNot)
+		genBytes(OpGreater, OpNot, operator)
 		break
 	case TokenPlus:
-		emitByte(OpAdd)
+		genByte(OpAdd, operator)
 		break
 	case TokenMinus:
-		emitByte(OpSubtract)
+		genByte(OpSubtract, operator)
 		break
 	case TokenStar:
-		emitByte(OpMultiply)
+		genByte(OpMultiply, operator)
 		break
 	case TokenSlash:
-		emitByte(OpDivide)
+		genByte(OpDivide, operator)
+		break
+	case TokenTildeSlash:
+		genByte(OpIntDivide, operator)
+		break
+	case TokenPercent:
+		genByte(OpModulo, operator)
+		break
+	case TokenStarStar:
+		genByte(OpPower, operator)
+		break
+	case TokenAmpersand:
+		genByte(OpBitAnd, operator)
+		break
+	case TokenPipe:
+		genByte(OpBitOr, operator)
+		break
+	case TokenCaret:
+		genByte(OpBitXor, operator)
+		break
+	case TokenLessLess:
+		genByte(OpShiftLeft, operator)
+		break
+	case TokenGreaterGreater:
+		genByte(OpShiftRight, operator)
 		break
 	default:
 		break // Unreachable
@@ -222,24 +310,553 @@ func parseGrouping() {
 	consumeToken(TokenRightParen, "Expect ')' after expression")
 }
 
+// numberLiteral converts number token to Value
+// Malformed and out of range literals are reported as errors
+func numberLiteral(token *Token) Value {
+	value, err := parseNumberLiteral(token.Value)
+	if err != nil {
+		errorAt(token, err.Error())
+		return IntVal(0)
+	}
+
+	return value
+}
+
+// stringLiteral converts string token to Value
+func stringLiteral(token *Token) Value {
+	value, err := parseStringLiteral(token.Value)
+	if err != nil {
+		errorAt(token, err.Error())
+	}
+
+	return StringVal(value)
+}
+
+func parseString() {
+	emitConstant(stringLiteral(&parser.Previous))
+}
+
+// parseInterpolation compiles "a${x}b" to the string parts and
+// expressions followed by OpBuildString
+func parseInterpolation() {
+	start := parser.Previous
+	parts := 0
+
+	for {
+		parts += emitStringPart()
+		parseExpression()
+		parts++
+
+		if parser.Current.Type != TokenInterpolation {
+			break
+		}
+		advanceParser()
+	}
+
+	consumeToken(TokenString, "Expect end of string after interpolation")
+	if parser.Previous.Type == TokenString {
+		parts += emitStringPart()
+	}
+
+	if parts > math.MaxUint8 {
+		errorAtPrev("Too many parts in string interpolation")
+		return
+	}
+
+	genBytes(OpBuildString, uint8(parts), start)
+}
+
+// emitStringPart emits the string part of interpolation unless its empty.
+// Returns the number of parts emitted
+func emitStringPart() int {
+	if emptyStringPart(&parser.Previous) {
+		return 0
+	}
+
+	emitConstant(stringLiteral(&parser.Previous))
+	return 1
+}
+
+func parseList() {
+	batches := newListBatches(parser.Previous)
+
+	for parser.Current.Type != TokenRightBracket {
+		parseExpression()
+		batches.add()
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBracket, "Expect ']' after list items")
+	batches.end()
+}
+
+// parseMap compiles map literal {key: value, ...}. There are no blocks
+// in expressions so '{' in prefix position is always a map
+func parseMap() {
+	batches := newMapBatches(parser.Previous)
+
+	for parser.Current.Type != TokenRightBrace {
+		parseExpression()
+		consumeToken(TokenColon, "Expect ':' after map key")
+		parseExpression()
+		batches.add()
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after map entries")
+	batches.end()
+}
+
+func parseIndex() {
+	bracket := parser.Previous
+	canAssign := parser.CanAssign
+	increment := parser.Increment
+	parser.Increment = nil
+
+	parseExpression()
+	consumeToken(TokenRightBracket, "Expect ']' after index")
+
+	switch {
+	case canAssign && matchToken(TokenEqual):
+		equal := parser.Previous
+		parseExpression()
+		genByte(OpIndexSet, equal)
+	case canAssign && isCompoundAssignment(parser.Current.Type):
+		// list[i] += v is list[i] = list[i] + v with list and i
+		// evaluated once
+		advanceParser()
+		operator := parser.Previous
+		genBytes(OpDup2, OpIndexGet, operator)
+		parseExpression()
+		genBytes(compoundOperators[operator.Type], OpIndexSet, operator)
+	case matchToken(TokenPlusPlus) || matchToken(TokenMinusMinus):
+		emitIncrement(parser.Previous, IncrementPostfix)
+		parser.Increment = increment
+	case increment != nil && !continuesCall(parser.Current.Type):
+		emitIncrement(*increment, 0)
+	default:
+		genByte(OpIndexGet, bracket)
+		parser.Increment = increment
+	}
+}
+
+func emitIncrement(operator Token, flags uint8) {
+	if operator.Type == TokenMinusMinus {
+		flags |= IncrementDecrement
+	}
+	genBytes(OpIndexIncrement, flags, operator)
+}
+
+// continuesCall tells if the token continues the call expression,
+// so the index before it isn't the last one
+func continuesCall(_type TokenType) bool {
+	return _type == TokenLeftBracket || _type == TokenDot || _type == TokenLeftParen
+}
+
+// compoundOperators has the operator of each compound assignment
+var compoundOperators = map[TokenType]uint8{
+	TokenPlusEqual:    OpAdd,
+	TokenMinusEqual:   OpSubtract,
+	TokenStarEqual:    OpMultiply,
+	TokenSlashEqual:   OpDivide,
+	TokenPercentEqual: OpModulo,
+}
+
+// isCompoundAssignment tells if the token is compound assignment like +=
+func isCompoundAssignment(_type TokenType) bool {
+	_, ok := compoundOperators[_type]
+	return ok
+}
+
+// parseIncrement compiles prefix ++list[index]. The operand is compiled
+// at call precedence and the last index in it applies the increment.
+// Postfix list[index]++ is compiled by parseIndex
+func parseIncrement() {
+	operator := parser.Previous
+	parser.Increment = &operator
+	parsePrecedence(PrecCall)
+}
+
+// parseMinusMinus compiles a--b as a - -b. -- is decrement only next
+// to index
+func parseMinusMinus() {
+	minus, negation := splitMinusMinus(parser.Previous)
+	parsePrefixed(PrecFactor, func() {
+		parsePrecedence(PrecUnary)
+		genByte(OpNegate, negation)
+	})
+	genByte(OpSubtract, minus)
+}
+
+// parseTernary compiles cond ? then : else. Only one of the branches
+// is evaluated
+func parseTernary() {
+	question := parser.Previous
+	elseJump := emitJump(OpJumpIfFalse)
+	emitByte(OpPop)
+	parseExpression()
+
+	consumeToken(TokenColon, "Expect ':' after then branch of conditional expression")
+	endJump := emitJump(OpJump)
+	patchJump(elseJump, &question)
+	emitByte(OpPop)
+
+	// Right associative: a ? b : c ? d : e is a ? b : (c ? d : e)
+	parsePrecedence(PrecTernary)
+	patchJump(endJump, &question)
+}
+
+// parseDot compiles method call value.name(arguments) or property
+// value.name
+func parseDot() {
+	consumeToken(TokenIdentifier, "Expect property name after '.'")
+	token := parser.Previous
+	name := makeConstant(StringVal(token.Value))
+
+	if !matchToken(TokenLeftParen) {
+		genBytes(OpGetProperty, name, token)
+		return
+	}
+	argCount := parseArguments()
+
+	genBytes(OpInvoke, name, token)
+	genByte(argCount, token)
+}
+
+// parseCall compiles function call: function(arguments)
+func parseCall() {
+	argCount := parseArguments()
+	emitBytes(OpCall, argCount)
+}
+
+func parseArguments() uint8 {
+	count := 0
+
+	if parser.Current.Type != TokenRightParen {
+		for {
+			parseExpression()
+			if count == math.MaxUint8 {
+				errorAtPrev("Can't have more than 255 arguments")
+			}
+			count++
+
+			if !matchToken(TokenComma) {
+				break
+			}
+		}
+	}
+
+	consumeToken(TokenRightParen, "Expect ')' after arguments")
+	return uint8(count)
+}
+
+// parseVariable compiles name bound by pattern or catch, or name of
+// built-in global
+func parseVariable() {
+	if slot, ok := locals.lookup(&parser.Previous); ok {
+		emitBytes(OpGetLocal, uint8(slot))
+		return
+	}
+
+	checkGlobal(&parser.Previous)
+	emitBytes(OpGetGlobal, makeConstant(StringVal(parser.Previous.Value)))
+}
+
+// parseMatch compiles match (subject) { pattern if guard => body, ... }.
+// The subject is stored to local slot and the arms test it in order.
+// Arms are separated with commas
+func parseMatch() {
+	keyword := parser.Previous
+	consumeToken(TokenLeftParen, "Expect '(' after 'match'")
+	parseExpression()
+	consumeToken(TokenRightParen, "Expect ')' after match subject")
+
+	saved := locals
+	slot := locals.addSlot(&keyword)
+	genBytes(OpDefineLocal, uint8(slot), keyword)
+	dispatch := genJump(OpJump, keyword)
+
+	consumeToken(TokenLeftBrace, "Expect '{' before match arms")
+	arms := []matchArm{}
+	endJumps := []int{}
+	for parser.Current.Type != TokenRightBrace {
+		arm := matchArm{TestStart: currentChunk().Count}
+		armLocals := locals.beginArm()
+
+		fails := []int{}
+		if value, ok := parsePattern(slot, &fails); ok && IsInt(value) {
+			arm.IsInt = true
+			arm.Int = AsInt(value)
+		}
+
+		guard := matchToken(TokenIf)
+		if guard {
+			parseExpression()
+			arm.IsInt = false
+		}
+		consumeToken(TokenArrow, "Expect '=>' after match pattern")
+		arrow := parser.Previous
+		if guard {
+			fails = append(fails, emitTest(arrow))
+		}
+
+		arm.BodyStart = currentChunk().Count
+		parseExpression()
+		endJumps = append(endJumps, genJump(OpJump, arrow))
+		endArm(fails, arrow)
+
+		locals = armLocals
+		arms = append(arms, arm)
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after match arms")
+	endMatch(keyword, slot, arms, dispatch, endJumps)
+	locals = saved
+}
+
+// parsePattern compiles the tests of pattern for the value in slot.
+// Returns the value of literal pattern
+func parsePattern(slot int, fails *[]int) (Value, bool) {
+	switch {
+	case matchToken(TokenIdentifier):
+		if !isWildcard(&parser.Previous) {
+			locals.bind(&parser.Previous, slot)
+		}
+	case matchToken(TokenLeftBracket):
+		parseListPattern(slot, fails)
+	case matchToken(TokenLeftBrace):
+		parseMapPattern(slot, fails)
+	default:
+		return parseLiteralPattern(slot, fails)
+	}
+
+	return Value{}, false
+}
+
+// parsePatternLiteral parses number, -number, string, true, false or nil
+func parsePatternLiteral() (Token, bool, bool) {
+	negative := matchToken(TokenMinus)
+	if negative {
+		consumeToken(TokenNumber, "Expect number after '-' in pattern")
+		return parser.Previous, true, parser.Previous.Type == TokenNumber
+	}
+
+	if !isPatternLiteral(parser.Current.Type) {
+		errorAtCurrent("Expect pattern")
+		return parser.Current, false, false
+	}
+	advanceParser()
+	return parser.Previous, false, true
+}
+
+// parseLiteralPattern compiles literal or low..high range pattern
+func parseLiteralPattern(slot int, fails *[]int) (Value, bool) {
+	low, negative, ok := parsePatternLiteral()
+	if !ok {
+		return Value{}, false
+	}
+	lowValue := patternValue(&low, negative)
+
+	if !matchToken(TokenDotDot) {
+		*fails = append(*fails, emitLiteralTest(slot, lowValue, low))
+		return lowValue, true
+	}
+
+	high, negative, ok := parsePatternLiteral()
+	if !ok {
+		return Value{}, false
+	}
+	highValue := patternValue(&high, negative)
+
+	if low.Type != TokenNumber || high.Type != TokenNumber {
+		errorAt(&low, "Range pattern bounds must be numbers")
+		return Value{}, false
+	}
+
+	*fails = append(*fails, emitRangeTest(slot, lowValue, highValue, low))
+	return Value{}, false
+}
+
+// parseListPattern compiles [a, b, ..]. Items that aren't _ are loaded
+// to slots of their own and matched with their patterns
+func parseListPattern(slot int, fails *[]int) {
+	bracket := parser.Previous
+	count := 0
+	rest := false
+
+	// The item count is set after parsing the items
+	test := emitListTest(slot, 0, false, bracket)
+	*fails = append(*fails, test)
+	// Operand of OpMatchList is before OpJumpIfFalse
+	operand := test - 2
+
+	for parser.Current.Type != TokenRightBracket {
+		if matchToken(TokenDotDot) {
+			rest = true
+			break
+		}
+
+		if !isWildcard(&parser.Current) {
+			item := locals.addSlot(&parser.Current)
+			emitLoad(slot, IntVal(int64(count)), item, bracket)
+			parsePattern(item, fails)
+		} else {
+			advanceParser()
+		}
+		count++
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBracket, "Expect ']' after list pattern")
+	if count > math.MaxInt8 {
+		errorAt(&bracket, "Too many items in list pattern")
+		return
+	}
+
+	currentChunk().Code[operand] = uint8(count)
+	if rest {
+		currentChunk().Code[operand] |= MatchListRest
+	}
+}
+
+// parseMapPattern compiles {key: pattern, ...}. The map can have
+// other keys too
+func parseMapPattern(slot int, fails *[]int) {
+	*fails = append(*fails, emitMapTest(slot, parser.Previous))
+
+	for parser.Current.Type != TokenRightBrace {
+		key, negative, ok := parsePatternLiteral()
+		if !ok {
+			return
+		}
+		keyValue := patternValue(&key, negative)
+		consumeToken(TokenColon, "Expect ':' after map pattern key")
+
+		*fails = append(*fails, emitKeyTest(slot, keyValue, key))
+		if !isWildcard(&parser.Current) {
+			value := locals.addSlot(&parser.Current)
+			emitLoad(slot, keyValue, value, key)
+			parsePattern(value, fails)
+		} else {
+			advanceParser()
+		}
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after map pattern")
+}
+
+// parseTry compiles try { body } catch (name) { handler } finally
+// { cleanup }. Either catch or finally can be left out, and so can the
+// name of catch. The value is the value of body, or of handler if body
+// threw. The value of cleanup is dropped
+func parseTry() {
+	keyword := parser.Previous
+	handler := genTry(keyword)
+	tries := []int{handler}
+	parseBlockExpression("try")
+	genByte(OpEndTry, keyword)
+	doneJumps := []int{genJump(OpJump, keyword)}
+	patchJump(handler, &keyword)
+
+	hasCatch := matchToken(TokenCatch)
+	if hasCatch {
+		saved := locals.beginArm()
+		if matchToken(TokenLeftParen) {
+			consumeToken(TokenIdentifier, "Expect exception name after '('")
+			slot := locals.addSlot(&parser.Previous)
+			locals.bind(&parser.Previous, slot)
+			genBytes(OpDefineLocal, uint8(slot), keyword)
+			consumeToken(TokenRightParen, "Expect ')' after exception name")
+		} else {
+			genByte(OpPop, keyword)
+		}
+
+		// Exceptions from the handler go to finally
+		handler = genTry(keyword)
+		tries = append(tries, handler)
+		parseBlockExpression("catch")
+		genByte(OpEndTry, keyword)
+		doneJumps = append(doneJumps, genJump(OpJump, keyword))
+		patchJump(handler, &keyword)
+		locals = saved
+	}
+
+	if !matchToken(TokenFinally) {
+		if !hasCatch {
+			errorAtCurrent("Expect 'catch' or 'finally' after try block")
+		}
+		genByte(OpRethrow, keyword)
+		for _, jump := range doneJumps {
+			patchJump(jump, &keyword)
+		}
+		return
+	}
+
+	// Both the exception and the value run the same cleanup code.
+	// The flag under it tells OpEndFinally which one it was
+	patchFinally(tries, &keyword)
+	genByte(OpTrue, keyword)
+	exceptionJump := genJump(OpJump, keyword)
+	for _, jump := range doneJumps {
+		patchJump(jump, &keyword)
+	}
+	genByte(OpFalse, keyword)
+	patchJump(exceptionJump, &keyword)
+
+	parseBlockExpression("finally")
+	genBytes(OpPop, OpEndFinally, keyword)
+}
+
+// parseBlockExpression compiles { expression } after the keyword
+func parseBlockExpression(keyword string) {
+	consumeToken(TokenLeftBrace, fmt.Sprintf("Expect '{' after '%s'", keyword))
+	parseExpression()
+	consumeToken(TokenRightBrace, fmt.Sprintf("Expect '}' after %s block", keyword))
+}
+
+// parseThrow compiles throw value
+func parseThrow() {
+	keyword := parser.Previous
+	parseExpression()
+	genByte(OpThrow, keyword)
+}
+
 func parseNumber() {
-	value, _ := strconv.ParseFloat(parser.Previous.Value, 64)
-	val := NumberVal(value)
-	emitConstant(val)
+	emitConstant(numberLiteral(&parser.Previous))
 }
 
 func parseUnary() {
-	operatorType := parser.Previous.Type
+	operator := parser.Previous
+	operatorType := operator.Type
 
 	// Compile the operand
 	parsePrecedence(PrecUnary)
 
 	switch operatorType {
 	case TokenBang:
-		emitByte(OpNot)
+		genByte(OpNot, operator)
 		break
 	case TokenMinus:
-		emitByte(OpNegate)
+		genByte(OpNegate, operator)
+		break
+	case TokenTilde:
+		genByte(OpBitNot, operator)
 		break
 	default:
 		return // Unreachable
@@ -256,14 +873,40 @@ func parsePrecedence(precedence Precedence) {
 		return
 	}
 
+	parsePrefixed(precedence, prefixRule)
+}
+
+// parsePrefixed compiles the expression that starts with prefixRule
+// and the infix operators of at least precedence after it
+func parsePrefixed(precedence Precedence, prefixRule ParseFn) {
+	canAssign := precedence <= PrecAssignment
+	increment := parser.Increment
+	parser.Increment = nil
+	parser.CanAssign = canAssign
 	prefixRule()
 
 	for precedence <= getRule(parser.Current.Type).Precedence {
 		advanceParser()
 		infixRule := getRule(parser.Previous.Type).Infix
+		parser.CanAssign = canAssign
+		parser.Increment = increment
 		infixRule()
+		increment = parser.Increment
+		parser.Increment = nil
 	}
 
+	if increment != nil && increment.Type == TokenMinusMinus {
+		// --x is -(-x) when x isn't index
+		first, second := splitMinusMinus(*increment)
+		genByte(OpNegate, second)
+		genByte(OpNegate, first)
+	} else if increment != nil {
+		errorAt(increment, "Invalid increment target")
+	}
+	if canAssign && (parser.Current.Type == TokenEqual || isCompoundAssignment(parser.Current.Type)) {
+		advanceParser()
+		errorAtPrev("Invalid assignment target")
+	}
 }
 
 func getRule(_type TokenType) *ParseRule {
@@ -273,55 +916,103 @@ func getRule(_type TokenType) *ParseRule {
 func initCompiler() {
 	// Init parse rule table
 	rules = []ParseRule{
-		{parseGrouping, nil, PrecCall},      // TokenLeftParen
-		{nil, nil, PrecNone},                // TokenRightParen
-		{nil, nil, PrecNone},                // TokenLeftBrace
-		{nil, nil, PrecNone},                // TokenRightBrace
-		{nil, nil, PrecNone},                // TokenComma
-		{nil, nil, PrecCall},                // TokenDot
-		{parseUnary, parseBinary, PrecTerm}, // TokenMinus
-		{nil, parseBinary, PrecTerm},        // TokenPlus
-		{nil, nil, PrecNone},                // TokenSemicolon
-		{nil, parseBinary, PrecFactor},      // TokenSlash
-		{nil, parseBinary, PrecFactor},      // TokenStar
-		{parseUnary, nil, PrecNone},         // TokenBang
-		{nil, parseBinary, PrecEquality},    // TokenBangEqual
-		{nil, nil, PrecNone},                // TokenEqual
-		{nil, parseBinary, PrecEquality},    // TokenEqualEqual
-		{nil, parseBinary, PrecComparison},  // TokenGreater
-		{nil, parseBinary, PrecComparison},  // TokenGreaterEqual
-		{nil, parseBinary, PrecComparison},  // TokenLess
-		{nil, parseBinary, PrecComparison},  // TokenLessEqual
-		{nil, nil, PrecNone},                // TokenIdentifier
-		{nil, nil, PrecNone},                // TokenString
-		{parseNumber, nil, PrecNone},        // TokenNumber
-		{nil, nil, PrecAnd},                 // TokenAnd
-		{nil, nil, PrecNone},                // TokenClass
-		{nil, nil, PrecNone},                // TokenElse
-		{parseLiteral, nil, PrecNone},       // TokenFalse
-		{nil, nil, PrecNone},                // TokenFor
-		{nil, nil, PrecNone},                // TokenFun
-		{nil, nil, PrecNone},                // TokenIf
-		{parseLiteral, nil, PrecNone},       // TokenNil
-		{nil, nil, PrecNone},                // TokenOr
-		{nil, nil, PrecNone},                // TokenPrint
-		{nil, nil, PrecNone},                // TokenReturn
-		{nil, nil, PrecNone},                // TokenSuper
-		{nil, nil, PrecNone},                // TokenThis
-		{parseLiteral, nil, PrecNone},       // TokenTrue
-		{nil, nil, PrecNone},                // TokenVar
-		{nil, nil, PrecNone},                // TokenWhile
-		{nil, nil, PrecNone},                // TokenError
-		{nil, nil, PrecNone},                // TokenEOF
+		{parseGrouping, parseCall, PrecCall},        // TokenLeftParen
+		{nil, nil, PrecNone},                        // TokenRightParen
+		{parseMap, nil, PrecNone},                   // TokenLeftBrace
+		{nil, nil, PrecNone},                        // TokenRightBrace
+		{nil, nil, PrecNone},                        // TokenComma
+		{nil, parseDot, PrecCall},                   // TokenDot
+		{parseUnary, parseBinary, PrecTerm},         // TokenMinus
+		{nil, parseBinary, PrecTerm},                // TokenPlus
+		{nil, nil, PrecNone},                        // TokenSemicolon
+		{nil, parseBinary, PrecFactor},              // TokenSlash
+		{nil, parseBinary, PrecFactor},              // TokenStar
+		{parseUnary, nil, PrecNone},                 // TokenBang
+		{nil, parseBinary, PrecEquality},            // TokenBangEqual
+		{nil, nil, PrecNone},                        // TokenEqual
+		{nil, parseBinary, PrecEquality},            // TokenEqualEqual
+		{nil, parseBinary, PrecComparison},          // TokenGreater
+		{nil, parseBinary, PrecComparison},          // TokenGreaterEqual
+		{nil, parseBinary, PrecComparison},          // TokenLess
+		{nil, parseBinary, PrecComparison},          // TokenLessEqual
+		{parseVariable, nil, PrecNone},              // TokenIdentifier
+		{parseString, nil, PrecNone},                // TokenString
+		{parseNumber, nil, PrecNone},                // TokenNumber
+		{nil, nil, PrecAnd},                         // TokenAnd
+		{nil, nil, PrecNone},                        // TokenClass
+		{nil, nil, PrecNone},                        // TokenElse
+		{parseLiteral, nil, PrecNone},               // TokenFalse
+		{nil, nil, PrecNone},                        // TokenFor
+		{nil, nil, PrecNone},                        // TokenFun
+		{nil, nil, PrecNone},                        // TokenIf
+		{parseLiteral, nil, PrecNone},               // TokenNil
+		{nil, nil, PrecNone},                        // TokenOr
+		{nil, nil, PrecNone},                        // TokenPrint
+		{nil, nil, PrecNone},                        // TokenReturn
+		{nil, nil, PrecNone},                        // TokenSuper
+		{nil, nil, PrecNone},                        // TokenThis
+		{parseLiteral, nil, PrecNone},               // TokenTrue
+		{nil, nil, PrecNone},                        // TokenVar
+		{nil, nil, PrecNone},                        // TokenWhile
+		{parseInterpolation, nil, PrecNone},         // TokenInterpolation
+		{parseList, parseIndex, PrecCall},           // TokenLeftBracket
+		{nil, nil, PrecNone},                        // TokenRightBracket
+		{nil, nil, PrecNone},                        // TokenColon
+		{nil, parseBinary, PrecFactor},              // TokenPercent
+		{nil, parseBinary, PrecPower},               // TokenStarStar
+		{nil, parseBinary, PrecBitAnd},              // TokenAmpersand
+		{nil, parseBinary, PrecBitOr},               // TokenPipe
+		{nil, parseBinary, PrecBitXor},              // TokenCaret
+		{parseUnary, nil, PrecNone},                 // TokenTilde
+		{nil, parseBinary, PrecShift},               // TokenLessLess
+		{nil, parseBinary, PrecShift},               // TokenGreaterGreater
+		{nil, nil, PrecNone},                        // TokenPlusEqual
+		{nil, nil, PrecNone},                        // TokenMinusEqual
+		{nil, nil, PrecNone},                        // TokenStarEqual
+		{nil, nil, PrecNone},                        // TokenSlashEqual
+		{nil, nil, PrecNone},                        // TokenPercentEqual
+		{parseIncrement, nil, PrecNone},             // TokenPlusPlus
+		{parseIncrement, parseMinusMinus, PrecTerm}, // TokenMinusMinus
+		{nil, parseTernary, PrecTernary},            // TokenQuestion
+		{nil, nil, PrecNone},                        // TokenDotDot
+		{nil, nil, PrecNone},                        // TokenArrow
+		{parseMatch, nil, PrecNone},                 // TokenMatch
+		{parseTry, nil, PrecNone},                   // TokenTry
+		{nil, nil, PrecNone},                        // TokenCatch
+		{nil, nil, PrecNone},                        // TokenFinally
+		{parseThrow, nil, PrecNone},                 // TokenThrow
+		{nil, parseBinary, PrecFactor},              // TokenTildeSlash
+		{nil, nil, PrecNone},                        // TokenError
+		{nil, nil, PrecNone},                        // TokenEOF
 	}
 }
 
 // Compile the source code
-func Compile(source string, chunk *Chunk) bool {
+// Source is parsed to syntax tree, resolved and then turned to bytecode.
+// If SinglePassCompiler is set, bytecode is emitted directly while parsing
+func Compile(source io.Reader, chunk *Chunk) bool {
+	if SinglePassCompiler {
+		return compileSinglePass(source, chunk)
+	}
+
+	expr, ok := Parse(source)
+	if !ok || !Resolve(expr) {
+		return false
+	}
+
+	compilingChunk = chunk
+	GenerateCode(expr)
+
+	endCompiler()
+	return !parser.HadError
+}
+
+func compileSinglePass(source io.Reader, chunk *Chunk) bool {
 	initCompiler()
 	InitScanner(source)
 
 	compilingChunk = chunk
+	locals = Locals{}
 	parser.HadError = false
 	parser.PanicMode = false
 
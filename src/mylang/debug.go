@@ -39,6 +39,12 @@ func (chunk *Chunk) DisassembleInstruction(offset int) int {
 		return chunk.simpleInstruction("OP_GREATER", offset)
 	case OpLess:
 		return chunk.simpleInstruction("OP_LESS", offset)
+	case OpNotEqual:
+		return chunk.simpleInstruction("OP_NOT_EQUAL", offset)
+	case OpGreaterEqual:
+		return chunk.simpleInstruction("OP_GREATER_EQUAL", offset)
+	case OpLessEqual:
+		return chunk.simpleInstruction("OP_LESS_EQUAL", offset)
 	case OpAdd:
 		return chunk.simpleInstruction("OP_ADD", offset)
 	case OpSubtract:
@@ -47,10 +53,84 @@ func (chunk *Chunk) DisassembleInstruction(offset int) int {
 		return chunk.simpleInstruction("OP_MULTIPLY", offset)
 	case OpDivide:
 		return chunk.simpleInstruction("OP_DIVIDE", offset)
+	case OpIntDivide:
+		return chunk.simpleInstruction("OP_INT_DIVIDE", offset)
+	case OpModulo:
+		return chunk.simpleInstruction("OP_MODULO", offset)
+	case OpPower:
+		return chunk.simpleInstruction("OP_POWER", offset)
+	case OpBitAnd:
+		return chunk.simpleInstruction("OP_BIT_AND", offset)
+	case OpBitOr:
+		return chunk.simpleInstruction("OP_BIT_OR", offset)
+	case OpBitXor:
+		return chunk.simpleInstruction("OP_BIT_XOR", offset)
+	case OpShiftLeft:
+		return chunk.simpleInstruction("OP_SHIFT_LEFT", offset)
+	case OpShiftRight:
+		return chunk.simpleInstruction("OP_SHIFT_RIGHT", offset)
 	case OpNot:
 		return chunk.simpleInstruction("OP_NOT", offset)
 	case OpNegate:
 		return chunk.simpleInstruction("OP_NEGATE", offset)
+	case OpBitNot:
+		return chunk.simpleInstruction("OP_BIT_NOT", offset)
+	case OpBuildString:
+		return chunk.byteInstruction("OP_BUILD_STRING", offset)
+	case OpBuildList:
+		return chunk.byteInstruction("OP_BUILD_LIST", offset)
+	case OpExtendList:
+		return chunk.byteInstruction("OP_EXTEND_LIST", offset)
+	case OpBuildMap:
+		return chunk.byteInstruction("OP_BUILD_MAP", offset)
+	case OpExtendMap:
+		return chunk.byteInstruction("OP_EXTEND_MAP", offset)
+	case OpIndexGet:
+		return chunk.simpleInstruction("OP_INDEX_GET", offset)
+	case OpIndexSet:
+		return chunk.simpleInstruction("OP_INDEX_SET", offset)
+	case OpInvoke:
+		return chunk.invokeInstruction("OP_INVOKE", offset)
+	case OpCall:
+		return chunk.byteInstruction("OP_CALL", offset)
+	case OpIndexIncrement:
+		return chunk.byteInstruction("OP_INDEX_INCREMENT", offset)
+	case OpPop:
+		return chunk.simpleInstruction("OP_POP", offset)
+	case OpDup2:
+		return chunk.simpleInstruction("OP_DUP2", offset)
+	case OpJump:
+		return chunk.jumpInstruction("OP_JUMP", offset)
+	case OpJumpIfFalse:
+		return chunk.jumpInstruction("OP_JUMP_IF_FALSE", offset)
+	case OpGetLocal:
+		return chunk.byteInstruction("OP_GET_LOCAL", offset)
+	case OpDefineLocal:
+		return chunk.byteInstruction("OP_DEFINE_LOCAL", offset)
+	case OpMatchList:
+		return chunk.byteInstruction("OP_MATCH_LIST", offset)
+	case OpMatchMap:
+		return chunk.simpleInstruction("OP_MATCH_MAP", offset)
+	case OpInRange:
+		return chunk.simpleInstruction("OP_IN_RANGE", offset)
+	case OpJumpTable:
+		return chunk.jumpTableInstruction("OP_JUMP_TABLE", offset)
+	case OpNoMatch:
+		return chunk.simpleInstruction("OP_NO_MATCH", offset)
+	case OpGetGlobal:
+		return chunk.constantInstruction("OP_GET_GLOBAL", offset)
+	case OpGetProperty:
+		return chunk.constantInstruction("OP_GET_PROPERTY", offset)
+	case OpTry:
+		return chunk.tryInstruction("OP_TRY", offset)
+	case OpEndTry:
+		return chunk.simpleInstruction("OP_END_TRY", offset)
+	case OpThrow:
+		return chunk.simpleInstruction("OP_THROW", offset)
+	case OpRethrow:
+		return chunk.simpleInstruction("OP_RETHROW", offset)
+	case OpEndFinally:
+		return chunk.simpleInstruction("OP_END_FINALLY", offset)
 	case OpReturn:
 		return chunk.simpleInstruction("OP_RETURN", offset)
 	default:
@@ -79,6 +159,62 @@ func (chunk *Chunk) constantInstruction(name string, offset int) int {
 	return offset + 2
 }
 
+func (chunk *Chunk) invokeInstruction(name string, offset int) int {
+	constant := chunk.Code[offset+1]
+	argCount := chunk.Code[offset+2]
+	fmt.Printf("%-16s (%d args) %4d '", name, argCount, constant)
+	PrintValue(chunk.Constants.Values[constant])
+	fmt.Printf("'\n")
+	return offset + 3
+}
+
+func (chunk *Chunk) byteInstruction(name string, offset int) int {
+	operand := chunk.Code[offset+1]
+	fmt.Printf("%-16s %4d\n", name, operand)
+	return offset + 2
+}
+
+// jumpInstruction prints the jump offset and the target
+func (chunk *Chunk) jumpInstruction(name string, offset int) int {
+	jump := int(chunk.Code[offset+1])<<8 | int(chunk.Code[offset+2])
+	fmt.Printf("%-16s %4d -> %d\n", name, offset, offset+3+jump)
+	return offset + 3
+}
+
+// tryInstruction prints the handler target and the finally target
+func (chunk *Chunk) tryInstruction(name string, offset int) int {
+	jump := int(chunk.Code[offset+1])<<8 | int(chunk.Code[offset+2])
+	fmt.Printf("%-16s %4d -> %d", name, offset, offset+3+jump)
+	if finally := int(chunk.Code[offset+3])<<8 | int(chunk.Code[offset+4]); finally != 0 {
+		fmt.Printf(", finally -> %d", offset+5+finally)
+	}
+	fmt.Printf("\n")
+	return offset + 5
+}
+
+// jumpTableInstruction prints the lowest value and the table with the
+// target of each value
+func (chunk *Chunk) jumpTableInstruction(name string, offset int) int {
+	constant := chunk.Code[offset+1]
+	count := int(chunk.Code[offset+2])
+	fmt.Printf("%-16s %4d '", name, constant)
+	PrintValue(chunk.Constants.Values[constant])
+	fmt.Printf("' (%d entries)\n", count)
+
+	low := AsInt(chunk.Constants.Values[constant])
+	table := offset + 3
+	for entry := 0; entry <= count; entry++ {
+		target := int(chunk.Code[table+2*entry])<<8 | int(chunk.Code[table+2*entry+1])
+		if entry == 0 {
+			fmt.Printf("     |   %16s -> %d\n", "default", target)
+		} else {
+			fmt.Printf("     |   %16d -> %d\n", low+int64(entry-1), target)
+		}
+	}
+
+	return table + 2*(count+1)
+}
+
 func (chunk *Chunk) simpleInstruction(name string, offset int) int {
 	fmt.Printf("%s\n", name)
 	return offset + 1
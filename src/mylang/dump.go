@@ -0,0 +1,280 @@
+package main
+
+// dump.go prints tokens and syntax trees for debugging the grammar
+// and for editor tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// ASTNode is the JSON schema of a syntax tree node.
+// Kind is one of "binary", "unary", "grouping", "interpolation", "literal",
+// "list", "map", "index", "index_set", "increment", "conditional",
+// "invoke", "call", "get", "variable", "match", "try" and "throw". Match
+// arms are "arm" and patterns are "literal_pattern", "range_pattern",
+// "binding_pattern", "list_pattern" and "map_pattern".
+// Only the fields used by the kind are included
+type ASTNode struct {
+	Kind   string `json:"kind"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Offset int    `json:"offset"`
+	// Operator is set for binary, unary, increment and index_set
+	Operator string `json:"operator,omitempty"`
+	// Token is the literal as it was written in source
+	Token      string   `json:"token,omitempty"`
+	Left       *ASTNode `json:"left,omitempty"`
+	Right      *ASTNode `json:"right,omitempty"`
+	Operand    *ASTNode `json:"operand,omitempty"`
+	Expression *ASTNode `json:"expression,omitempty"`
+	// Parts are the string parts and expressions of interpolation
+	Parts []*ASTNode `json:"parts,omitempty"`
+	Items []*ASTNode `json:"items,omitempty"`
+	// Keys and Values are the entries of map
+	Keys   []*ASTNode `json:"keys,omitempty"`
+	Values []*ASTNode `json:"values,omitempty"`
+	// Object, Index and Value are set for index and index_set
+	Object *ASTNode `json:"object,omitempty"`
+	Index  *ASTNode `json:"index,omitempty"`
+	Value  *ASTNode `json:"value,omitempty"`
+	// Postfix is set for list[index]++ and list[index]--
+	Postfix bool `json:"postfix,omitempty"`
+	// Condition, Then and Else are set for conditional
+	Condition *ASTNode `json:"condition,omitempty"`
+	Then      *ASTNode `json:"then,omitempty"`
+	Else      *ASTNode `json:"else,omitempty"`
+	// Name is the method name of invoke, the property name of get, the
+	// name of variable and the name of binding_pattern. Object is the
+	// receiver of invoke and get and the function of call
+	Name      string     `json:"name,omitempty"`
+	Arguments []*ASTNode `json:"arguments,omitempty"`
+	// Subject and Arms are set for match
+	Subject *ASTNode   `json:"subject,omitempty"`
+	Arms    []*ASTNode `json:"arms,omitempty"`
+	// Pattern, Guard and Body are set for arm
+	Pattern *ASTNode `json:"pattern,omitempty"`
+	Guard   *ASTNode `json:"guard,omitempty"`
+	Body    *ASTNode `json:"body,omitempty"`
+	// Body, Name, Handler and Cleanup are set for try. Value is set
+	// for throw
+	Handler *ASTNode `json:"handler,omitempty"`
+	Cleanup *ASTNode `json:"cleanup,omitempty"`
+	// Low and High are the bounds of range_pattern
+	Low  *ASTNode `json:"low,omitempty"`
+	High *ASTNode `json:"high,omitempty"`
+	// Rest is set for list_pattern that ends with ..
+	Rest bool `json:"rest,omitempty"`
+}
+
+// PrintTokens scans the whole source and prints every token
+func PrintTokens(source io.Reader) {
+	InitScanner(source)
+
+	for {
+		token := ScanToken()
+		fmt.Printf("%4d:%-4d %-14s '%s'\n", token.Line, token.Column, token.Type, token.Value)
+		if token.Doc != "" {
+			fmt.Printf("          doc %q\n", token.Doc)
+		}
+
+		if token.Type == TokenEOF {
+			break
+		}
+	}
+}
+
+// PrintAST prints the syntax tree as indented text
+func PrintAST(expr Expr) {
+	printASTNode(NewASTNode(expr), 0)
+}
+
+// PrintASTJSON prints the syntax tree as JSON
+func PrintASTJSON(expr Expr) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetEscapeHTML(false)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(NewASTNode(expr))
+}
+
+// NewASTNode converts the syntax tree to ASTNode tree. Patterns are
+// converted too
+func NewASTNode(expr Expr) *ASTNode {
+	pos := expr.Pos()
+	node := &ASTNode{Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+
+	switch expr := expr.(type) {
+	case *BinaryExpr:
+		node.Kind = "binary"
+		node.Operator = expr.Operator.Value
+		node.Left = NewASTNode(expr.Left)
+		node.Right = NewASTNode(expr.Right)
+	case *UnaryExpr:
+		node.Kind = "unary"
+		node.Operator = expr.Operator.Value
+		node.Operand = NewASTNode(expr.Operand)
+	case *GroupingExpr:
+		node.Kind = "grouping"
+		node.Expression = NewASTNode(expr.Expression)
+	case *InterpolationExpr:
+		node.Kind = "interpolation"
+		for _, part := range expr.Parts {
+			node.Parts = append(node.Parts, NewASTNode(part))
+		}
+	case *LiteralExpr:
+		node.Kind = "literal"
+		node.Token = expr.Token.Value
+	case *ListExpr:
+		node.Kind = "list"
+		node.Items = newASTNodes(expr.Items)
+	case *MapExpr:
+		node.Kind = "map"
+		node.Keys = newASTNodes(expr.Keys)
+		node.Values = newASTNodes(expr.Values)
+	case *IndexExpr:
+		node.Kind = "index"
+		node.Object = NewASTNode(expr.Object)
+		node.Index = NewASTNode(expr.Index)
+	case *IndexSetExpr:
+		node.Kind = "index_set"
+		node.Operator = expr.Operator.Value
+		node.Object = NewASTNode(expr.Object)
+		node.Index = NewASTNode(expr.Index)
+		node.Value = NewASTNode(expr.Value)
+	case *IncrementExpr:
+		node.Kind = "increment"
+		node.Operator = expr.Operator.Value
+		node.Postfix = expr.Postfix
+		node.Object = NewASTNode(expr.Target.Object)
+		node.Index = NewASTNode(expr.Target.Index)
+	case *ConditionalExpr:
+		node.Kind = "conditional"
+		node.Condition = NewASTNode(expr.Condition)
+		node.Then = NewASTNode(expr.Then)
+		node.Else = NewASTNode(expr.Else)
+	case *InvokeExpr:
+		node.Kind = "invoke"
+		node.Name = expr.Name.Value
+		node.Object = NewASTNode(expr.Object)
+		node.Arguments = newASTNodes(expr.Args)
+	case *CallExpr:
+		node.Kind = "call"
+		node.Object = NewASTNode(expr.Callee)
+		node.Arguments = newASTNodes(expr.Args)
+	case *GetExpr:
+		node.Kind = "get"
+		node.Name = expr.Name.Value
+		node.Object = NewASTNode(expr.Object)
+	case *VariableExpr:
+		node.Kind = "variable"
+		node.Name = expr.Name.Value
+	case *MatchExpr:
+		node.Kind = "match"
+		node.Subject = NewASTNode(expr.Subject)
+		for _, arm := range expr.Arms {
+			node.Arms = append(node.Arms, newArmNode(arm))
+		}
+	case *TryExpr:
+		node.Kind = "try"
+		node.Body = NewASTNode(expr.Body)
+		if expr.Name != nil {
+			node.Name = expr.Name.Value
+		}
+		if expr.Handler != nil {
+			node.Handler = NewASTNode(expr.Handler)
+		}
+		if expr.Cleanup != nil {
+			node.Cleanup = NewASTNode(expr.Cleanup)
+		}
+	case *ThrowExpr:
+		node.Kind = "throw"
+		node.Value = NewASTNode(expr.Value)
+	case *LiteralPattern:
+		node.Kind = "literal_pattern"
+		node.Token = expr.Token.Value
+		if expr.Negative {
+			node.Token = "-" + node.Token
+		}
+	case *RangePattern:
+		node.Kind = "range_pattern"
+		node.Low = NewASTNode(expr.Low)
+		node.High = NewASTNode(expr.High)
+	case *BindingPattern:
+		node.Kind = "binding_pattern"
+		node.Name = expr.Name.Value
+	case *ListPattern:
+		node.Kind = "list_pattern"
+		for _, element := range expr.Elements {
+			node.Items = append(node.Items, NewASTNode(element))
+		}
+		node.Rest = expr.Rest
+	case *MapPattern:
+		node.Kind = "map_pattern"
+		for i := range expr.Keys {
+			node.Keys = append(node.Keys, NewASTNode(expr.Keys[i]))
+			node.Values = append(node.Values, NewASTNode(expr.Values[i]))
+		}
+	}
+
+	return node
+}
+
+func newArmNode(arm *MatchArm) *ASTNode {
+	pos := arm.Pattern.Pos()
+	node := &ASTNode{Kind: "arm", Line: pos.Line, Column: pos.Column, Offset: pos.Offset}
+	node.Pattern = NewASTNode(arm.Pattern)
+	if arm.Guard != nil {
+		node.Guard = NewASTNode(arm.Guard)
+	}
+	node.Body = NewASTNode(arm.Body)
+
+	return node
+}
+
+func newASTNodes(exprs []Expr) []*ASTNode {
+	nodes := []*ASTNode{}
+	for _, expr := range exprs {
+		nodes = append(nodes, NewASTNode(expr))
+	}
+
+	return nodes
+}
+
+func printASTNode(node *ASTNode, depth int) {
+	fmt.Printf("%s%s", strings.Repeat("  ", depth), node.Kind)
+	if node.Operator != "" {
+		fmt.Printf(" %s", node.Operator)
+	}
+	if node.Token != "" {
+		fmt.Printf(" %s", node.Token)
+	}
+	if node.Name != "" {
+		fmt.Printf(" %s", node.Name)
+	}
+	if node.Postfix {
+		fmt.Printf(" postfix")
+	}
+	if node.Rest {
+		fmt.Printf(" rest")
+	}
+	fmt.Printf(" [%d:%d]\n", node.Line, node.Column)
+
+	children := []*ASTNode{node.Left, node.Right, node.Operand, node.Expression, node.Object, node.Index, node.Value,
+		node.Condition, node.Then, node.Else, node.Subject, node.Pattern, node.Guard, node.Body, node.Low, node.High,
+		node.Handler, node.Cleanup}
+	children = append(children, node.Parts...)
+	children = append(children, node.Items...)
+	for i := range node.Keys {
+		children = append(children, node.Keys[i], node.Values[i])
+	}
+	children = append(children, node.Arguments...)
+	for _, child := range append(children, node.Arms...) {
+		if child != nil {
+			printASTNode(child, depth+1)
+		}
+	}
+}
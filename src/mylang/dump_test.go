@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestTokenTypeNames(t *testing.T) {
+	seen := map[string]TokenType{}
+	for _type := TokenType(0); _type <= TokenEOF; _type++ {
+		name := _type.String()
+		if name == "" || strings.HasPrefix(name, "TokenType(") {
+			t.Errorf("token type %d has no name", _type)
+		}
+		if other, ok := seen[name]; ok {
+			t.Errorf("token types %d and %d are both %s", other, _type, name)
+		}
+		seen[name] = _type
+	}
+
+	if name := TokenType(TokenEOF + 1).String(); name != fmt.Sprintf("TokenType(%d)", TokenEOF+1) {
+		t.Errorf("unknown token type is %s", name)
+	}
+	if name := TokenType(-1).String(); name != "TokenType(-1)" {
+		t.Errorf("negative token type is %s", name)
+	}
+}
+
+func TestPrintTokens(t *testing.T) {
+	// Columns count runes and the malformed number is one token
+	source := "/// doc\n/// more\na ~/\n  \"s\\t\" 1x é"
+	want := "   3:1    IDENTIFIER     'a'\n" +
+		"          doc \"doc\\nmore\"\n" +
+		"   3:3    TILDE_SLASH    '~/'\n" +
+		"   4:3    STRING         '\"s\\t\"'\n" +
+		"   4:9    NUMBER         '1x'\n" +
+		"   4:12   IDENTIFIER     'é'\n" +
+		"   4:13   EOF            ''\n"
+
+	output := captureOutput(t, func() { PrintTokens(strings.NewReader(source)) })
+	if output != want {
+		t.Errorf("PrintTokens printed %q, want %q", output, want)
+	}
+}
+
+func TestPrintTokensStopsAtError(t *testing.T) {
+	want := "   1:1    ERROR          'Unterminated string.'\n" +
+		"   1:4    EOF            ''\n"
+
+	output := captureOutput(t, func() { PrintTokens(strings.NewReader("\"ab")) })
+	if output != want {
+		t.Errorf("PrintTokens printed %q, want %q", output, want)
+	}
+}
+
+func TestPrintAST(t *testing.T) {
+	want := "unary - [1:1]\n" +
+		"  increment ++ postfix [1:2]\n" +
+		"    variable l [1:2]\n" +
+		"    literal 0 [1:4]\n"
+
+	expr, ok := Parse(strings.NewReader("-l[0]++"))
+	if !ok {
+		t.Fatal("-l[0]++ didn't parse")
+	}
+	if output := captureOutput(t, func() { PrintAST(expr) }); output != want {
+		t.Errorf("PrintAST printed %q, want %q", output, want)
+	}
+}
+
+func TestASTJSONSchema(t *testing.T) {
+	tests := []struct {
+		Source string
+		JSON   string
+	}{
+		{"f(1, x)", `{"kind":"call","line":1,"column":1,"offset":0,` +
+			`"object":{"kind":"variable","line":1,"column":1,"offset":0,"name":"f"},` +
+			`"arguments":[{"kind":"literal","line":1,"column":3,"offset":2,"token":"1"},` +
+			`{"kind":"variable","line":1,"column":6,"offset":5,"name":"x"}]}`},
+		// Empty lists are left out like other unused fields
+		{"[]", `{"kind":"list","line":1,"column":1,"offset":0}`},
+		{"{}", `{"kind":"map","line":1,"column":1,"offset":0}`},
+		{"match (1) { }", `{"kind":"match","line":1,"column":1,"offset":0,` +
+			`"subject":{"kind":"literal","line":1,"column":8,"offset":7,"token":"1"}}`},
+	}
+
+	for _, test := range tests {
+		expr, ok := Parse(strings.NewReader(test.Source))
+		if !ok {
+			t.Errorf("%s didn't parse", test.Source)
+			continue
+		}
+		encoded, err := json.Marshal(NewASTNode(expr))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(encoded) != test.JSON {
+			t.Errorf("%s is %s, want %s", test.Source, encoded, test.JSON)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	checkCompileErrors(t, []errorProgram{
+		{Source: "1 +", Output: "[line 1:4] Error at end: Expect expression\n"},
+		{Source: "(1", Output: "[line 1:3] Error at end: Expect ')' after expression\n"},
+		{Source: "[1, 2", Output: "[line 1:6] Error at end: Expect ']' after list items\n"},
+		{Source: "fs.", Output: "[line 1:4] Error at end: Expect property name after '.'\n"},
+		{Source: "1 2", Output: "[line 1:3] Error at '2': Expect end of expression\n"},
+		{Source: "{1: }", Output: "[line 1:5] Error at '}': Expect expression\n"},
+		{Source: "1 = 2", Output: "[line 1:3] Error at '=': Invalid assignment target\n"},
+		{Source: "try 1", Output: "[line 1:5] Error at '1': Expect '{' after 'try'\n"},
+		// Only the first error is reported. The single pass compiler
+		// resolves names while parsing, so it finds the undefined name
+		// before the syntax error. The AST is resolved only if it parses
+		{Source: "a.", Output: "[line 1:3] Error at end: Expect property name after '.'\n",
+			SinglePass: "[line 1:1] Error at 'a': Undefined variable 'a'\n"},
+		{Source: "[a, b]", Output: "[line 1:2] Error at 'a': Undefined variable 'a'\n"},
+	})
+
+	output := captureOutput(t, func() {
+		if _, ok := Parse(strings.NewReader("1 +")); ok {
+			t.Error("1 + parsed")
+		}
+	})
+	if output != "[line 1:4] Error at end: Expect expression\n" {
+		t.Errorf("Parse printed %q", output)
+	}
+}
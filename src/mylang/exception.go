@@ -0,0 +1,124 @@
+package main
+
+// exception.go has the exception handling of the VM. Runtime errors are
+// thrown as error objects: maps with "message" and "trace". Any other
+// value can be thrown with throw and caught with try
+
+import (
+	"fmt"
+	"os"
+)
+
+// Handler is an exception handler pushed by OpTry
+type Handler struct {
+	// Target is where the execution continues with the exception
+	Target int
+	// Finally is where the finally block of the try starts, or -1 if
+	// the try has none. Exit skips catch blocks and runs only these
+	Finally int
+	// StackPos is the stack position when the handler was pushed
+	StackPos int
+}
+
+// newErrorObject creates error object {"message": message, "trace": trace}
+func newErrorObject(message string, trace []Value) Value {
+	object := NewMapObject()
+	object.Set(StringVal("message"), StringVal(message))
+	object.Set(StringVal("trace"), ListVal(trace))
+	return MapVal(object)
+}
+
+// errorObjectFields returns the message and trace of error object.
+// ok is false if the value isn't error object
+func errorObjectFields(value Value) (message string, trace []Value, ok bool) {
+	if !IsMap(value) {
+		return "", nil, false
+	}
+
+	object := AsMap(value)
+	messageValue, found, _ := object.Get(StringVal("message"))
+	if !found || !IsString(messageValue) {
+		return "", nil, false
+	}
+	traceValue, found, _ := object.Get(StringVal("trace"))
+	if !found || !IsList(traceValue) {
+		return "", nil, false
+	}
+
+	return AsString(messageValue), AsList(traceValue).Items, true
+}
+
+// stackTrace returns the frames of the current instruction, innermost
+// first. Scripts have only one frame
+func (vm *VM) stackTrace() []Value {
+	// IP is already past the current instruction
+	frame := fmt.Sprintf("[line %d:%d] in script", vm.Chunk.Lines[vm.IP-1], vm.Chunk.Columns[vm.IP-1])
+	return []Value{StringVal(frame)}
+}
+
+// exitSignal is thrown by exit. Scripts never get it as catch blocks
+// are skipped for it
+var exitSignal = NativeVal(&NativeFunction{Name: "exit"})
+
+// throw unwinds the stack to the innermost handler and continues from
+// it with the value. trace is kept for reporting the value if it isn't
+// caught. exitSignal only stops at finally blocks and isn't reported.
+// Returns false if there was no handler
+func (vm *VM) throw(value Value, trace []Value) bool {
+	vm.Trace = trace
+	vm.Exiting = IsNative(value) && AsNative(value) == AsNative(exitSignal)
+
+	for len(vm.Handlers) > 0 {
+		handler := vm.Handlers[len(vm.Handlers)-1]
+		vm.Handlers = vm.Handlers[:len(vm.Handlers)-1]
+
+		target := handler.Target
+		if vm.Exiting {
+			target = handler.Finally
+		}
+		if target >= 0 {
+			vm.StackPos = handler.StackPos
+			vm.Push(value)
+			vm.IP = target
+			return true
+		}
+	}
+
+	if !vm.Exiting {
+		reportUncaught(value, trace)
+	}
+	return false
+}
+
+// uncaught returns the result of the program when throw found no
+// handler
+func (vm *VM) uncaught() int {
+	if vm.Exiting {
+		return InterpretExit
+	}
+	return InterpretRuntimeError
+}
+
+// throwValue throws value of throw expression. Error objects keep their
+// own trace
+func (vm *VM) throwValue(value Value) bool {
+	if _, trace, ok := errorObjectFields(value); ok {
+		return vm.throw(value, trace)
+	}
+
+	return vm.throw(value, vm.stackTrace())
+}
+
+// reportUncaught prints the exception that no handler caught. Errors
+// are printed as their message
+func reportUncaught(value Value, trace []Value) {
+	if message, _, ok := errorObjectFields(value); ok {
+		fmt.Fprintf(os.Stderr, "%s\n", message)
+	} else {
+		fmt.Fprintf(os.Stderr, "Uncaught exception: %s\n", FormatValue(value))
+	}
+
+	for _, frame := range trace {
+		fmt.Fprintf(os.Stderr, "%s\n", FormatValue(frame))
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+// list.go has the list object and its methods
+
+// ListObject is mutable list of values. Lists are shared by reference
+type ListObject struct {
+	Items []Value
+}
+
+// NativeMethod is method implemented in Go. Errors are reported with
+// runTimeError and by returning false. Functions of built-in modules
+// are methods of the module
+type NativeMethod func(receiver Value, args []Value) (Value, bool)
+
+// listMethods are the methods that can be invoked on lists
+var listMethods = map[string]NativeMethod{
+	"push":   listPush,
+	"pop":    listPop,
+	"len":    listLen,
+	"insert": listInsert,
+	"remove": listRemove,
+	"slice":  listSlice,
+}
+
+// checkArity reports error if the method didn't get the right number
+// of arguments
+func checkArity(name string, args []Value, min int, max int) bool {
+	if len(args) >= min && len(args) <= max {
+		return true
+	}
+
+	if min == max {
+		runTimeError("Method '%s' expects %d arguments but got %d.", name, min, len(args))
+	} else {
+		runTimeError("Method '%s' expects %d to %d arguments but got %d.", name, min, max, len(args))
+	}
+	return false
+}
+
+// listIndex converts index value to position in the list. Negative
+// indexes count from the end. Length is the size of the list, or the size
+// + 1 for positions where an item can be inserted
+func listIndex(index Value, length int) (int, bool) {
+	if !IsInt(index) {
+		runTimeError("List index must be an integer.")
+		return 0, false
+	}
+
+	position := AsInt(index)
+	if position < 0 {
+		position += int64(length)
+	}
+
+	if position < 0 || position >= int64(length) {
+		runTimeError("List index out of range.")
+		return 0, false
+	}
+
+	return int(position), true
+}
+
+// sliceBound converts slice bound to position in the list. Bounds out of
+// the list are clamped to the start or the end like in Python
+func sliceBound(bound Value, length int) (int, bool) {
+	if !IsInt(bound) {
+		runTimeError("Slice bound must be an integer.")
+		return 0, false
+	}
+
+	position := AsInt(bound)
+	if position < 0 {
+		position += int64(length)
+	}
+
+	if position < 0 {
+		return 0, true
+	}
+	if position > int64(length) {
+		return length, true
+	}
+	return int(position), true
+}
+
+// IndexGet returns list[index]
+func (list *ListObject) IndexGet(index Value) (Value, bool) {
+	position, ok := listIndex(index, len(list.Items))
+	if !ok {
+		return Value{}, false
+	}
+
+	return list.Items[position], true
+}
+
+// IndexSet sets list[index] = value
+func (list *ListObject) IndexSet(index Value, value Value) bool {
+	position, ok := listIndex(index, len(list.Items))
+	if !ok {
+		return false
+	}
+
+	list.Items[position] = value
+	return true
+}
+
+// push(value) adds the value to the end of the list
+func listPush(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("push", args, 1, 1) {
+		return Value{}, false
+	}
+
+	list := AsList(receiver)
+	list.Items = append(list.Items, args[0])
+	return NilVal(), true
+}
+
+// pop() removes and returns the last value
+func listPop(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("pop", args, 0, 0) {
+		return Value{}, false
+	}
+
+	list := AsList(receiver)
+	if len(list.Items) == 0 {
+		runTimeError("Can't pop from empty list.")
+		return Value{}, false
+	}
+
+	last := list.Items[len(list.Items)-1]
+	list.Items = list.Items[:len(list.Items)-1]
+	return last, true
+}
+
+// len() returns the number of values in the list
+func listLen(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("len", args, 0, 0) {
+		return Value{}, false
+	}
+
+	return IntVal(int64(len(AsList(receiver).Items))), true
+}
+
+// insertIndex converts insert index to position in the list. Negative
+// indexes count from the end like in list[index], so -1 is before the
+// last value. The length of the list is the position after the end
+func insertIndex(index Value, length int) (int, bool) {
+	if IsInt(index) && AsInt(index) == int64(length) {
+		return length, true
+	}
+
+	return listIndex(index, length)
+}
+
+// insert(index, value) adds the value before index. Index can be
+// the length of the list to add the value to the end
+func listInsert(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("insert", args, 2, 2) {
+		return Value{}, false
+	}
+
+	list := AsList(receiver)
+	position, ok := insertIndex(args[0], len(list.Items))
+	if !ok {
+		return Value{}, false
+	}
+
+	list.Items = append(list.Items, Value{})
+	copy(list.Items[position+1:], list.Items[position:])
+	list.Items[position] = args[1]
+	return NilVal(), true
+}
+
+// remove(index) removes and returns the value at index
+func listRemove(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("remove", args, 1, 1) {
+		return Value{}, false
+	}
+
+	list := AsList(receiver)
+	position, ok := listIndex(args[0], len(list.Items))
+	if !ok {
+		return Value{}, false
+	}
+
+	removed := list.Items[position]
+	list.Items = append(list.Items[:position], list.Items[position+1:]...)
+	return removed, true
+}
+
+// slice(start, [end]) returns new list with the values from start to end
+func listSlice(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("slice", args, 1, 2) {
+		return Value{}, false
+	}
+
+	list := AsList(receiver)
+	start, ok := sliceBound(args[0], len(list.Items))
+	if !ok {
+		return Value{}, false
+	}
+
+	end := len(list.Items)
+	if len(args) == 2 {
+		if end, ok = sliceBound(args[1], len(list.Items)); !ok {
+			return Value{}, false
+		}
+	}
+
+	items := []Value{}
+	if start < end {
+		items = append(items, list.Items[start:end]...)
+	}
+	return ListVal(items), true
+}
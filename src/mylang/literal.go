@@ -0,0 +1,68 @@
+package main
+
+// literal.go has the code of list and map literals that is shared by
+// the single pass compiler (compiler.go) and the syntax tree pipeline
+// (codegen.go), so both give the same bytecode.
+//
+// The items are pushed on the stack and collected to the list in
+// batches: OpBuildList creates the list from the first batch and
+// OpExtendList appends each batch after it. Maps are built the same way
+// with OpBuildMap and OpExtendMap from batches of keys and values. A
+// literal never has more than one batch on the stack, so it can be
+// longer than the stack and than the one byte count operand allows.
+
+// LiteralBatch is the most stack slots that one batch of a literal
+// takes. It leaves room on the stack for the values under the literal,
+// which can be the unfinished batches of the literals around it
+const LiteralBatch = 64
+
+// literalBatches counts the items of one literal and emits the batches
+type literalBatches struct {
+	Build  uint8
+	Extend uint8
+	// Size is the most items in one batch. Map entries are counted as
+	// items
+	Size int
+	// Pending is the number of items pushed after the last batch
+	Pending int
+	// Started is set when the collection is created
+	Started bool
+	// Token is the opening bracket or brace. Batches are emitted at its
+	// line
+	Token Token
+}
+
+func newListBatches(bracket Token) literalBatches {
+	return literalBatches{Build: OpBuildList, Extend: OpExtendList, Size: LiteralBatch, Token: bracket}
+}
+
+// newMapBatches counts the entries of map. Key and value take a slot each
+func newMapBatches(brace Token) literalBatches {
+	return literalBatches{Build: OpBuildMap, Extend: OpExtendMap, Size: LiteralBatch / 2, Token: brace}
+}
+
+// add counts the item that was pushed and emits the batch if it's full
+func (b *literalBatches) add() {
+	b.Pending++
+	if b.Pending == b.Size {
+		b.flush()
+	}
+}
+
+// end emits the rest of the items. Empty literal creates empty collection
+func (b *literalBatches) end() {
+	if b.Pending > 0 || !b.Started {
+		b.flush()
+	}
+}
+
+func (b *literalBatches) flush() {
+	op := b.Extend
+	if !b.Started {
+		op = b.Build
+	}
+	genBytes(op, uint8(b.Pending), b.Token)
+
+	b.Pending = 0
+	b.Started = true
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// listLiteral returns list literal of count items. Item i is i % 100,
+// so there aren't too many constants
+func listLiteral(count int) string {
+	items := []string{}
+	for i := 0; i < count; i++ {
+		items = append(items, fmt.Sprint(i%100))
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+func TestLongListLiterals(t *testing.T) {
+	for _, count := range []int{0, 1, LiteralBatch - 1, LiteralBatch, LiteralBatch + 1, 2 * LiteralBatch, 1000} {
+		source := fmt.Sprintf("match (%s) { l => [l.len(), l[0], l[-1]] }", listLiteral(count))
+		want := fmt.Sprintf("[%d, 0, %d]\n", count, (count-1)%100)
+		if count == 0 {
+			source = listLiteral(0)
+			want = "[]\n"
+		}
+
+		for _, singlePass := range []bool{false, true} {
+			SinglePassCompiler = singlePass
+			if output := runProgram(t, source); output != want {
+				t.Errorf("list of %d items printed %q, want %q", count, output, want)
+			}
+		}
+		SinglePassCompiler = false
+	}
+}
+
+func TestLongMapLiterals(t *testing.T) {
+	for _, count := range []int{1, LiteralBatch/2 - 1, LiteralBatch / 2, LiteralBatch/2 + 1, LiteralBatch + 1, 1000} {
+		// Key i % 100 has value i / 100, so later entries replace
+		// earlier ones
+		entries := []string{}
+		for i := 0; i < count; i++ {
+			entries = append(entries, fmt.Sprintf("%d: %d", i%100, i/100))
+		}
+		last := count - 1
+		source := fmt.Sprintf("match ({%s}) { m => [m.len(), m[%d]] }", strings.Join(entries, ", "), last%100)
+		want := fmt.Sprintf("[%d, %d]\n", min(count, 100), last/100)
+
+		for _, singlePass := range []bool{false, true} {
+			SinglePassCompiler = singlePass
+			if output := runProgram(t, source); output != want {
+				t.Errorf("map of %d entries printed %q, want %q", count, output, want)
+			}
+		}
+		SinglePassCompiler = false
+	}
+}
+
+func TestLiteralBatches(t *testing.T) {
+	// Items are nil so they aren't constants
+	items := func(count int) string {
+		return strings.TrimSuffix(strings.Repeat("nil, ", count), ", ")
+	}
+	entries := func(count int) string {
+		return strings.TrimSuffix(strings.Repeat("nil: nil, ", count), ", ")
+	}
+	names := map[uint8]string{
+		OpBuildList: "OP_BUILD_LIST", OpExtendList: "OP_EXTEND_LIST",
+		OpBuildMap: "OP_BUILD_MAP", OpExtendMap: "OP_EXTEND_MAP",
+	}
+
+	tests := []struct {
+		Source  string
+		Batches string
+	}{
+		{"[]", "OP_BUILD_LIST 0"},
+		{"[" + items(LiteralBatch) + "]", "OP_BUILD_LIST 64"},
+		{"[" + items(LiteralBatch+1) + "]", "OP_BUILD_LIST 64, OP_EXTEND_LIST 1"},
+		{"[" + items(2*LiteralBatch+2) + "]", "OP_BUILD_LIST 64, OP_EXTEND_LIST 64, OP_EXTEND_LIST 2"},
+		{"{}", "OP_BUILD_MAP 0"},
+		{"{" + entries(LiteralBatch/2) + "}", "OP_BUILD_MAP 32"},
+		{"{" + entries(LiteralBatch/2+1) + "}", "OP_BUILD_MAP 32, OP_EXTEND_MAP 1"},
+		// The nested list is finished before the batch it is in
+		{"[" + items(LiteralBatch-1) + ", [nil]]", "OP_BUILD_LIST 1, OP_BUILD_LIST 64"},
+	}
+
+	for _, test := range tests {
+		chunk := compileChunk(t, test.Source)
+
+		batches := []string{}
+		for offset := 0; offset < chunk.Count; offset += chunk.instructionLength(offset) {
+			if name, ok := names[chunk.Code[offset]]; ok {
+				batches = append(batches, fmt.Sprintf("%s %d", name, chunk.Code[offset+1]))
+			}
+		}
+		if strings.Join(batches, ", ") != test.Batches {
+			t.Errorf("%.20s... has batches %q, want %q", test.Source, batches, test.Batches)
+		}
+	}
+}
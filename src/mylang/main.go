@@ -15,6 +15,18 @@ package main
 // DebugPrintCode if true, prints dissasembled chunk from compiler
 var DebugPrintCode = true
 
+// DebugTraceExecution if true, prints the stack and each instruction
+// as the VM runs them
+var DebugTraceExecution = true
+
+// OptimizationLevel tells what optimizations compiler does.
+// 0 keeps the bytecode as it's emitted, 1 runs the peephole optimizer
+var OptimizationLevel = 1
+
+// SinglePassCompiler if true, compiler emits bytecode while parsing
+// instead of building the syntax tree first
+var SinglePassCompiler = false
+
 func main() {
 	// Target files:
 	// main_compiler.go (tag: gloxcompiler)
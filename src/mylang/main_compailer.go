@@ -20,17 +20,20 @@ var DefaultFileMod os.FileMode = 0644
 
 var vm = VM{}
 
-func readFile(path string) string {
-	fileBytes, err := ioutil.ReadFile(path)
+// openFile opens the source file, or standard input for -. The
+// scanner reads it as it goes
+func openFile(path string) *os.File {
+	if path == "-" {
+		return os.Stdin
+	}
+
+	file, err := os.Open(path)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 		os.Exit(74)
 	}
 
-	// ioutil.ReadFile doesn't include the the EOF byte so we need to add it
-	sourceBytes := append(fileBytes, FileEOF)
-
-	return string(sourceBytes)
+	return file
 }
 
 func writeBytes(bytes []byte) {
@@ -45,9 +48,11 @@ func writeBytes(bytes []byte) {
 func runFile(path string) {
 	chunk := Chunk{}
 	chunk.InitChunk()
-	source := readFile(path)
+	source := openFile(path)
+	ok := Compile(source, &chunk)
+	source.Close()
 
-	if !Compile(source, &chunk) {
+	if !ok {
 		os.Exit(65)
 	}
 
@@ -64,16 +69,42 @@ func runFile(path string) {
 
 }
 
+// parseOptions sets the compiler options from arguments
+// and returns the rest of the arguments
+func parseOptions(args []string) []string {
+	rest := []string{}
+
+	for _, arg := range args {
+		switch arg {
+		case "-O0":
+			OptimizationLevel = 0
+		case "-O1":
+			OptimizationLevel = 1
+		case "-single-pass":
+			SinglePassCompiler = true
+		default:
+			rest = append(rest, arg)
+		}
+	}
+
+	return rest
+}
+
 func mainTarget() {
+	// Register Value structs so they can be encoded to binary file
+	RegisterValues()
+
 	// Initialize vm
 	vm.InitVM()
 
-	if len(os.Args) == 1 {
+	args := parseOptions(os.Args[1:])
+
+	if len(args) == 0 {
 		//repl()
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+	} else if len(args) == 1 {
+		runFile(args[0])
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: gloxc [path]\n")
+		fmt.Fprintf(os.Stderr, "Usage: gloxc [-O0|-O1] [-single-pass] [path|-]\n")
 		os.Exit(64)
 	}
 }
@@ -8,8 +8,9 @@ package main
 import (
 	"bufio"
 	"fmt"
-	"io/ioutil"
+	"io"
 	"os"
+	"strings"
 )
 
 var vm = VM{}
@@ -26,30 +27,49 @@ func repl() {
 			break
 		}
 
-		// reader.Readstring doesn't include the the EOF byte so we need to add it
-		line += string(FileEOF)
-
-		vm.Interpret(line)
+		if vm.Interpret(strings.NewReader(line)) == InterpretExit {
+			os.Exit(vm.ExitCode)
+		}
 	}
 }
 
-func readFile(path string) string {
-	fileBytes, err := ioutil.ReadFile(path)
+// openFile opens the source file, or standard input for -. The
+// scanner reads it as it goes
+func openFile(path string) *os.File {
+	if path == "-" {
+		return os.Stdin
+	}
+
+	file, err := os.Open(path)
 	if err != nil {
 		fmt.Printf("%s\n", err)
 		os.Exit(74)
 	}
 
-	// ioutil.ReadFile doesn't include the the EOF byte so we need to add it
-	sourceBytes := append(fileBytes, FileEOF)
+	return file
+}
+
+// runFile runs the script with the arguments given to it
+func runFile(path string, args []string) {
+	source := openFile(path)
+	result := runSource(source, args)
+	source.Close()
 
-	return string(sourceBytes)
+	exitOnFailure(result)
 }
 
-func runFile(path string) {
-	source := readFile(path)
-	result := vm.Interpret(source)
+// runSource runs the source code with the arguments given to it
+func runSource(source io.Reader, args []string) int {
+	SetArgs(args)
+	return vm.Interpret(source)
+}
 
+// exitOnFailure exits with the code of exit, or with the error code if
+// running failed
+func exitOnFailure(result int) {
+	if result == InterpretExit {
+		os.Exit(vm.ExitCode)
+	}
 	if result == InterpretCompileError {
 		os.Exit(65)
 	}
@@ -58,6 +78,64 @@ func runFile(path string) {
 	}
 }
 
+// dumpTokens prints the tokens of the file
+func dumpTokens(path string) {
+	source := openFile(path)
+	PrintTokens(source)
+	source.Close()
+}
+
+// dumpAST prints the syntax tree of the file as text or JSON
+func dumpAST(path string, asJSON bool) {
+	source := openFile(path)
+	expr, ok := Parse(source)
+	source.Close()
+	if !ok {
+		os.Exit(65)
+	}
+
+	if !asJSON {
+		PrintAST(expr)
+		return
+	}
+
+	if err := PrintASTJSON(expr); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(70)
+	}
+}
+
+// parseOptions sets the permissions of scripts from the arguments
+// and returns the rest of the arguments. Options end at the first
+// argument that isn't option, so the arguments of the script are
+// not parsed, or at --. literal tells if they ended at --, so the
+// path comes next even if it starts with -
+func parseOptions(args []string) (rest []string, literal bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:], true
+		}
+		isPermission, err := vm.Permissions.ParseFlag(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(64)
+		}
+		if !isPermission {
+			return args[i:], false
+		}
+	}
+
+	return []string{}, false
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: gloxrun [--allow-read[=dir]] [--allow-write[=dir]] [--allow-env] [--] [path|- [args...]]\n")
+	fmt.Fprintf(os.Stderr, "       gloxrun [options] -e <expression> [--] [args...]\n")
+	fmt.Fprintf(os.Stderr, "       gloxrun tokens <path>\n")
+	fmt.Fprintf(os.Stderr, "       gloxrun ast [-json] <path>\n")
+	os.Exit(64)
+}
+
 func mainTarget() {
 	// Register Value structs so they can be encoded to binary file
 	RegisterValues()
@@ -65,12 +143,29 @@ func mainTarget() {
 	// Initialize vm
 	vm.InitVM()
 
-	if len(os.Args) == 1 {
+	args, literal := parseOptions(os.Args[1:])
+
+	if len(args) == 0 {
 		repl()
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+	} else if literal {
+		runFile(args[0], args[1:])
+	} else if len(args) == 2 && args[0] == "tokens" {
+		dumpTokens(args[1])
+	} else if len(args) == 2 && args[0] == "ast" {
+		dumpAST(args[1], false)
+	} else if len(args) == 3 && args[0] == "ast" && args[1] == "-json" {
+		dumpAST(args[2], true)
+	} else if len(args) >= 2 && args[0] == "-e" {
+		// The code is one expression like a script, so there are no
+		// statements or ';'. -- after it ends the options too
+		scriptArgs := args[2:]
+		if len(scriptArgs) > 0 && scriptArgs[0] == "--" {
+			scriptArgs = scriptArgs[1:]
+		}
+		exitOnFailure(runSource(strings.NewReader(args[1]), scriptArgs))
+	} else if strings.HasPrefix(args[0], "-") && args[0] != "-" {
+		usage()
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: gloxrun [path]\n")
-		os.Exit(64)
+		runFile(args[0], args[1:])
 	}
 }
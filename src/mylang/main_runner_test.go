@@ -0,0 +1,63 @@
+// +build gloxrun,!gloxvm,!gloxcompiler
+
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseOptions(t *testing.T) {
+	saved := vm.Permissions
+	defer func() { vm.Permissions = saved }()
+
+	tests := []struct {
+		Args    []string
+		Rest    []string
+		Literal bool
+	}{
+		{[]string{"--allow-env", "a.glox", "--allow-read"}, []string{"a.glox", "--allow-read"}, false},
+		{[]string{"--allow-env", "--", "--allow-read", "-x"}, []string{"--allow-read", "-x"}, true},
+		{[]string{"-e", "args", "--", "-x"}, []string{"-e", "args", "--", "-x"}, false},
+		{[]string{"--"}, []string{}, true},
+	}
+
+	for _, test := range tests {
+		vm.Permissions = Permissions{}
+		rest, literal := parseOptions(test.Args)
+		if !reflect.DeepEqual(rest, test.Rest) || literal != test.Literal {
+			t.Errorf("parseOptions(%q) returned %q, %t, want %q, %t",
+				test.Args, rest, literal, test.Rest, test.Literal)
+		}
+		if vm.Permissions.Read != nil {
+			t.Errorf("parseOptions(%q) allowed reading", test.Args)
+		}
+	}
+}
+
+func TestRunInlineExpression(t *testing.T) {
+	tests := []struct {
+		Source string
+		Args   []string
+		Output string
+		Result int
+	}{
+		{"1 + 2", nil, "3\n", InterpretOk},
+		{"env.args", []string{"-x", "y"}, "[\"-x\", \"y\"]\n", InterpretOk},
+		// -e takes an expression, not statements
+		{"print 1 + 2;", nil, "[line 1:1] Error at 'print': Expect expression\n", InterpretCompileError},
+		{"1 + 2;", nil, "[line 1:6] Error at ';': Expect end of expression\n", InterpretCompileError},
+	}
+
+	for _, test := range tests {
+		result := -1
+		output := captureOutput(t, func() {
+			result = runSource(strings.NewReader(test.Source), test.Args)
+		})
+		if output != test.Output || result != test.Result {
+			t.Errorf("-e %q printed %q and returned %d, want %q and %d",
+				test.Source, output, result, test.Output, test.Result)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 )
 
 var vm = VM{}
@@ -29,7 +30,10 @@ func readFile(path string) []byte {
 
 // run file get bytes from path with readFileFunction
 // decodes it to struct and feeds it to vm
-func runFile(path string) {
+// runFile runs the chunk with the arguments given to the script
+func runFile(path string, args []string) {
+	SetArgs(args)
+
 	chunk := Chunk{}
 	chunk.InitChunk()
 	source := readFile(path)
@@ -45,10 +49,38 @@ func runFile(path string) {
 		log.Fatal("decode error:", err)
 	}
 
-	vm.InterpretBytes(chunkStruct)
+	switch vm.InterpretBytes(chunkStruct) {
+	case InterpretExit:
+		os.Exit(vm.ExitCode)
+	case InterpretCompileError:
+		os.Exit(65)
+	}
 
 }
 
+// parseOptions sets the permissions of scripts from the arguments
+// and returns the rest of the arguments. Options end at the first
+// argument that isn't option, so the arguments of the script are
+// not parsed, or at --. literal tells if they ended at --, so the
+// path comes next even if it starts with -
+func parseOptions(args []string) (rest []string, literal bool) {
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:], true
+		}
+		isPermission, err := vm.Permissions.ParseFlag(arg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+			os.Exit(64)
+		}
+		if !isPermission {
+			return args[i:], false
+		}
+	}
+
+	return []string{}, false
+}
+
 func mainTarget() {
 	// Register Value structs so they can be decoded from binary file
 	RegisterValues()
@@ -56,12 +88,14 @@ func mainTarget() {
 	// Initialize vm
 	vm.InitVM()
 
-	if len(os.Args) == 1 {
+	args, literal := parseOptions(os.Args[1:])
+
+	if len(args) == 0 {
 		//repl()
-	} else if len(os.Args) == 2 {
-		runFile(os.Args[1])
+	} else if literal || !strings.HasPrefix(args[0], "-") {
+		runFile(args[0], args[1:])
 	} else {
-		fmt.Fprintf(os.Stderr, "Usage: gloxvm [path]\n")
+		fmt.Fprintf(os.Stderr, "Usage: gloxvm [--allow-read[=dir]] [--allow-write[=dir]] [--allow-env] [--] [path [args...]]\n")
 		os.Exit(64)
 	}
 }
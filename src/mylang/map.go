@@ -0,0 +1,264 @@
+package main
+
+// map.go has the map object and its methods
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// MapObject is mutable map from keys to values. Entries are kept in
+// insertion order, so keys(), values() and printing list them in the
+// order they were added. Maps are shared by reference
+type MapObject struct {
+	Entries []MapEntry
+	// Index has the position of each key in Entries
+	Index map[MapKey]int
+}
+
+// MapEntry is key and value pair in the map
+type MapEntry struct {
+	Key   Value
+	Value Value
+}
+
+// MapKey is the comparable form of a hashable value. Only one of the
+// fields besides Type is used
+type MapKey struct {
+	Type   ValueType
+	Bool   bool
+	Int    int64
+	Number float64
+	Chars  string
+}
+
+// mapMethods are the methods that can be invoked on maps
+var mapMethods = map[string]NativeMethod{
+	"keys":   mapKeys,
+	"values": mapValues,
+	"has":    mapHas,
+	"get":    mapGet,
+	"remove": mapRemove,
+	"len":    mapLen,
+}
+
+// NewMapObject creates an empty map
+func NewMapObject() *MapObject {
+	return &MapObject{Index: map[MapKey]int{}}
+}
+
+// mapKey converts the value to MapKey. Numbers, strings, bools and nil
+// are hashable. Reports error for other values.
+// Floats that equal an integer use the integer key, as 1 == 1.0
+func mapKey(value Value) (MapKey, bool) {
+	switch value.Type {
+	case ValBool:
+		return MapKey{Type: ValBool, Bool: AsBool(value)}, true
+	case ValNil:
+		return MapKey{Type: ValNil}, true
+	case ValInt:
+		return MapKey{Type: ValInt, Int: AsInt(value)}, true
+	case ValNumber:
+		number := AsNumber(value)
+		if math.IsNaN(number) {
+			runTimeError("Map key can't be NaN.")
+			return MapKey{}, false
+		}
+		// -0 is converted too, as -0 == 0
+		if number == math.Trunc(number) && number >= math.MinInt64 && number < math.MaxInt64 {
+			return MapKey{Type: ValInt, Int: int64(number)}, true
+		}
+		return MapKey{Type: ValNumber, Number: number}, true
+	case ValString:
+		return MapKey{Type: ValString, Chars: AsString(value)}, true
+	default:
+		runTimeError("Map key must be a number, string, bool or nil.")
+		return MapKey{}, false
+	}
+}
+
+// Get returns the value of the key. found is false if the key isn't
+// in the map. ok is false if the key isn't hashable
+func (m *MapObject) Get(key Value) (value Value, found bool, ok bool) {
+	hashKey, ok := mapKey(key)
+	if !ok {
+		return Value{}, false, false
+	}
+
+	position, found := m.Index[hashKey]
+	if !found {
+		return NilVal(), false, true
+	}
+	return m.Entries[position].Value, true, true
+}
+
+// Set adds the key or replaces its value
+func (m *MapObject) Set(key Value, value Value) bool {
+	hashKey, ok := mapKey(key)
+	if !ok {
+		return false
+	}
+
+	if position, found := m.Index[hashKey]; found {
+		m.Entries[position].Value = value
+		return true
+	}
+
+	m.Index[hashKey] = len(m.Entries)
+	m.Entries = append(m.Entries, MapEntry{key, value})
+	return true
+}
+
+// IndexGet returns map[key]. Missing key is an error
+func (m *MapObject) IndexGet(key Value) (Value, bool) {
+	value, found, ok := m.Get(key)
+	if !ok {
+		return Value{}, false
+	}
+
+	if !found {
+		runTimeError("Undefined key %s.", quoteKey(key))
+		return Value{}, false
+	}
+	return value, true
+}
+
+// IndexSet sets map[key] = value
+func (m *MapObject) IndexSet(key Value, value Value) bool {
+	return m.Set(key, value)
+}
+
+// keys() returns list of the keys
+func mapKeys(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("keys", args, 0, 0) {
+		return Value{}, false
+	}
+
+	m := AsMap(receiver)
+	keys := make([]Value, len(m.Entries))
+	for i, entry := range m.Entries {
+		keys[i] = entry.Key
+	}
+	return ListVal(keys), true
+}
+
+// values() returns list of the values
+func mapValues(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("values", args, 0, 0) {
+		return Value{}, false
+	}
+
+	m := AsMap(receiver)
+	values := make([]Value, len(m.Entries))
+	for i, entry := range m.Entries {
+		values[i] = entry.Value
+	}
+	return ListVal(values), true
+}
+
+// has(key) tells if the key is in the map
+func mapHas(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("has", args, 1, 1) {
+		return Value{}, false
+	}
+
+	_, found, ok := AsMap(receiver).Get(args[0])
+	return BoolVal(found), ok
+}
+
+// get(key, [default]) returns the value of the key, or the default
+// (nil if not given) if the key isn't in the map
+func mapGet(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("get", args, 1, 2) {
+		return Value{}, false
+	}
+
+	value, found, ok := AsMap(receiver).Get(args[0])
+	if ok && !found && len(args) == 2 {
+		return args[1], true
+	}
+	return value, ok
+}
+
+// remove(key) removes the key and returns its value. Missing key
+// is an error
+func mapRemove(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("remove", args, 1, 1) {
+		return Value{}, false
+	}
+
+	m := AsMap(receiver)
+	removed, ok := m.IndexGet(args[0])
+	if !ok {
+		return Value{}, false
+	}
+
+	hashKey, _ := mapKey(args[0])
+	position := m.Index[hashKey]
+	delete(m.Index, hashKey)
+
+	m.Entries = append(m.Entries[:position], m.Entries[position+1:]...)
+	for i := position; i < len(m.Entries); i++ {
+		key, _ := mapKey(m.Entries[i].Key)
+		m.Index[key] = i
+	}
+
+	return removed, true
+}
+
+// len() returns the number of entries in the map
+func mapLen(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("len", args, 0, 0) {
+		return Value{}, false
+	}
+
+	return IntVal(int64(len(AsMap(receiver).Entries))), true
+}
+
+// formatMap formats the map as {"a": 1, "b": 2}
+func formatMap(m *MapObject, printing map[interface{}]bool) string {
+	if printing[m] {
+		return "{...}"
+	}
+	printing[m] = true
+	defer delete(printing, m)
+
+	entries := make([]string, len(m.Entries))
+	for i, entry := range m.Entries {
+		entries[i] = formatItem(entry.Key, printing) + ": " + formatItem(entry.Value, printing)
+	}
+
+	return "{" + strings.Join(entries, ", ") + "}"
+}
+
+// mapsEqual checks that maps have the same keys with equal values.
+// Order of the entries doesn't matter
+func mapsEqual(a *MapObject, b *MapObject, compared map[[2]interface{}]bool) bool {
+	pair := [2]interface{}{a, b}
+	if a == b || compared[pair] {
+		return true
+	}
+	if len(a.Entries) != len(b.Entries) {
+		return false
+	}
+
+	compared[pair] = true
+	for _, entry := range a.Entries {
+		key, _ := mapKey(entry.Key)
+		position, found := b.Index[key]
+		if !found || !valuesEqual(entry.Value, b.Entries[position].Value, compared) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// quoteKey formats the key for error messages
+func quoteKey(key Value) string {
+	if IsString(key) {
+		return strconv.Quote(AsString(key))
+	}
+	return FormatValue(key)
+}
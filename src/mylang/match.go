@@ -0,0 +1,306 @@
+package main
+
+// match.go has the parts of match expressions that are shared by the
+// single pass compiler (compiler.go) and the syntax tree pipeline
+// (resolver.go, codegen.go): the local slots of subjects and bindings,
+// the pattern tests and the jump table. Both emit the code with these
+// functions so they give the same bytecode.
+//
+// The subject of match is stored to a local slot and each pattern test
+// pushes bool that is checked with OpJumpIfFalse. List elements and map
+// values that have pattern are loaded to slots of their own. Names bound
+// by patterns refer to the slot of the value they matched
+
+import (
+	"fmt"
+	"math"
+)
+
+// Local is a name bound by match pattern
+type Local struct {
+	Name string
+	Slot int
+}
+
+// Locals tracks the bound names and the local slots in use
+type Locals struct {
+	Names []Local
+	// SlotCount is the number of slots in use
+	SlotCount int
+	// ArmStart is where the names of the current arm start in Names
+	ArmStart int
+}
+
+var locals = Locals{}
+
+// addSlot reserves new local slot
+func (l *Locals) addSlot(token *Token) int {
+	if l.SlotCount == StackMax {
+		errorAt(token, "Too many local values in match")
+		return 0
+	}
+
+	l.SlotCount++
+	return l.SlotCount - 1
+}
+
+// bind adds the name for the slot. Names must be unique in one pattern
+func (l *Locals) bind(name *Token, slot int) {
+	for _, local := range l.Names[l.ArmStart:] {
+		if local.Name == name.Value {
+			errorAt(name, fmt.Sprintf("Name '%s' is already bound in this pattern", name.Value))
+			return
+		}
+	}
+
+	l.Names = append(l.Names, Local{name.Value, slot})
+}
+
+// lookup returns the slot of the innermost binding of the name.
+// Returns false if the name isn't bound
+func (l *Locals) lookup(name *Token) (int, bool) {
+	for i := len(l.Names) - 1; i >= 0; i-- {
+		if l.Names[i].Name == name.Value {
+			return l.Names[i].Slot, true
+		}
+	}
+
+	return 0, false
+}
+
+// beginArm starts the names of new arm. Returns the state to restore
+// after the arm
+func (l *Locals) beginArm() Locals {
+	saved := *l
+	l.ArmStart = len(l.Names)
+	return saved
+}
+
+// isWildcard tells if the token is the _ pattern
+func isWildcard(token *Token) bool {
+	return token.Type == TokenIdentifier && token.Value == "_"
+}
+
+// patternValue converts the literal token of pattern to Value
+func patternValue(token *Token, negative bool) Value {
+	switch token.Type {
+	case TokenNumber:
+		value := numberLiteral(token)
+		if negative {
+			// Can't overflow as literals are not negative
+			value, _ = unaryArithmetic(OpNegate, value)
+		}
+		return value
+	case TokenString:
+		return stringLiteral(token)
+	case TokenTrue:
+		return BoolVal(true)
+	case TokenFalse:
+		return BoolVal(false)
+	default:
+		return NilVal()
+	}
+}
+
+// isPatternLiteral tells if the token can start literal pattern
+func isPatternLiteral(_type TokenType) bool {
+	switch _type {
+	case TokenNumber, TokenString, TokenTrue, TokenFalse, TokenNil:
+		return true
+	default:
+		return false
+	}
+}
+
+// emitValue pushes the literal value
+func emitValue(value Value, token Token) {
+	switch {
+	case IsNil(value):
+		genByte(OpNil, token)
+	case IsBool(value) && AsBool(value):
+		genByte(OpTrue, token)
+	case IsBool(value):
+		genByte(OpFalse, token)
+	default:
+		genBytes(OpConstant, makeConstantAt(value, &token), token)
+	}
+}
+
+// emitTest jumps out of the arm if the test pushed false. Returns the
+// jump to patch with endArm
+func emitTest(token Token) int {
+	jump := genJump(OpJumpIfFalse, token)
+	genByte(OpPop, token)
+	return jump
+}
+
+// emitLiteralTest tests that the value in slot equals the literal
+func emitLiteralTest(slot int, value Value, token Token) int {
+	genBytes(OpGetLocal, uint8(slot), token)
+	emitValue(value, token)
+	genByte(OpEqual, token)
+	return emitTest(token)
+}
+
+// emitRangeTest tests that the value in slot is from low to high
+func emitRangeTest(slot int, low Value, high Value, token Token) int {
+	genBytes(OpGetLocal, uint8(slot), token)
+	emitValue(low, token)
+	emitValue(high, token)
+	genByte(OpInRange, token)
+	return emitTest(token)
+}
+
+// emitListTest tests that the value in slot is list of count items,
+// or at least count items with rest
+func emitListTest(slot int, count int, rest bool, token Token) int {
+	flags := uint8(count)
+	if rest {
+		flags |= MatchListRest
+	}
+	genBytes(OpGetLocal, uint8(slot), token)
+	genBytes(OpMatchList, flags, token)
+	return emitTest(token)
+}
+
+// emitMapTest tests that the value in slot is map
+func emitMapTest(slot int, token Token) int {
+	genBytes(OpGetLocal, uint8(slot), token)
+	genByte(OpMatchMap, token)
+	return emitTest(token)
+}
+
+// emitKeyTest tests that the map in slot has the key
+func emitKeyTest(slot int, key Value, token Token) int {
+	genBytes(OpGetLocal, uint8(slot), token)
+	name := makeConstantAt(StringVal("has"), &token)
+	emitValue(key, token)
+	genBytes(OpInvoke, name, token)
+	genByte(1, token)
+	return emitTest(token)
+}
+
+// emitLoad stores slot[index] to the target slot
+func emitLoad(slot int, index Value, target int, token Token) {
+	genBytes(OpGetLocal, uint8(slot), token)
+	emitValue(index, token)
+	genByte(OpIndexGet, token)
+	genBytes(OpDefineLocal, uint8(target), token)
+}
+
+// matchArm has the positions of compiled arm for the jump table
+type matchArm struct {
+	TestStart int
+	BodyStart int
+	// IsInt is set if the pattern is integer literal without guard
+	IsInt bool
+	Int   int64
+}
+
+// endArm patches the failed tests of the arm to pop the test result
+func endArm(fails []int, token Token) {
+	if len(fails) == 0 {
+		return
+	}
+
+	for _, fail := range fails {
+		patchJump(fail, &token)
+	}
+	genByte(OpPop, token)
+}
+
+// endMatch emits the error for values that no arm matched and the jump
+// table if the arms allow it. dispatch is the jump after storing the
+// subject, that is patched to the jump table
+func endMatch(keyword Token, slot int, arms []matchArm, dispatch int, endJumps []int) {
+	noMatch := currentChunk().Count
+	genBytes(OpGetLocal, uint8(slot), keyword)
+	genByte(OpNoMatch, keyword)
+
+	// Jump tables are used for the leading integer arms
+	values := []int64{}
+	for _, arm := range arms {
+		if !arm.IsInt {
+			break
+		}
+		values = append(values, arm.Int)
+	}
+
+	low, table, ok := planJumpTable(values)
+	if ok {
+		patchJump(dispatch, &keyword)
+
+		// Values not in table continue from the first arm after them
+		fallback := noMatch
+		if len(values) < len(arms) {
+			fallback = arms[len(values)].TestStart
+		}
+
+		genBytes(OpGetLocal, uint8(slot), keyword)
+		genBytes(OpJumpTable, makeConstantAt(IntVal(low), &keyword), keyword)
+		genByte(uint8(len(table)), keyword)
+		emitAddress(fallback, keyword)
+		for _, arm := range table {
+			if arm < 0 {
+				emitAddress(fallback, keyword)
+			} else {
+				emitAddress(arms[arm].BodyStart, keyword)
+			}
+		}
+	} else {
+		// Jump just to the next instruction
+		currentChunk().Code[dispatch] = 0
+		currentChunk().Code[dispatch+1] = 0
+	}
+
+	for _, jump := range endJumps {
+		patchJump(jump, &keyword)
+	}
+}
+
+// emitAddress writes absolute jump table address
+func emitAddress(address int, token Token) {
+	if address > math.MaxUint16 {
+		errorAt(&token, "Too much code to jump over")
+	}
+	genBytes(uint8(address>>8), uint8(address), token)
+}
+
+// planJumpTable decides if the integer arms are dense enough for jump
+// table. Returns the lowest value and the arm of each value from it,
+// -1 for the gaps. The first arm of each value is used as it would
+// match first
+func planJumpTable(values []int64) (int64, []int, bool) {
+	arms := map[int64]int{}
+	low, high := int64(0), int64(0)
+	for i, value := range values {
+		if _, ok := arms[value]; ok {
+			continue
+		}
+		arms[value] = i
+		if len(arms) == 1 || value < low {
+			low = value
+		}
+		if len(arms) == 1 || value > high {
+			high = value
+		}
+	}
+
+	if len(arms) < 3 {
+		return 0, nil, false
+	}
+	// Overflow free high - low
+	span := uint64(high) - uint64(low)
+	if span >= math.MaxUint8 || span >= 2*uint64(len(arms)) {
+		return 0, nil, false
+	}
+
+	table := make([]int, span+1)
+	for i := range table {
+		table[i] = -1
+		if arm, ok := arms[low+int64(i)]; ok {
+			table[i] = arm
+		}
+	}
+	return low, table, true
+}
@@ -0,0 +1,105 @@
+package main
+
+// module.go has the built-in modules. Modules are global values whose
+// functions are called like methods, module.function(args), and whose
+// constants are read as properties, module.name
+
+import "fmt"
+
+// ModuleObject is built-in module
+type ModuleObject struct {
+	Name string
+	// Functions get the module as receiver
+	Functions map[string]NativeMethod
+	Constants map[string]Value
+}
+
+// NativeFunction is built-in function
+type NativeFunction struct {
+	Name string
+	// Function gets the function value as receiver
+	Function NativeMethod
+}
+
+// builtins are the global names. Compilers check names against them
+// and the VM reads them with OpGetGlobal
+var builtins = map[string]Value{}
+
+// defineModule adds the module to the globals
+func defineModule(module *ModuleObject) {
+	builtins[module.Name] = ModuleVal(module)
+}
+
+func init() {
+	defineModule(mathModule)
+	defineModule(stringModule)
+	defineModule(timeModule)
+	defineModule(fsModule)
+	defineModule(ioModule)
+	defineModule(jsonModule)
+	defineModule(envModule)
+	defineNative(exitNative)
+	SetArgs([]string{})
+}
+
+// defineNative adds the function to the globals
+func defineNative(function *NativeFunction) {
+	builtins[function.Name] = NativeVal(function)
+}
+
+// checkGlobal reports error if the name isn't built-in global
+func checkGlobal(name *Token) {
+	if _, ok := builtins[name.Value]; !ok {
+		errorAt(name, fmt.Sprintf("Undefined variable '%s'", name.Value))
+	}
+}
+
+// getProperty returns the constant of module
+func getProperty(object Value, name string) (Value, bool) {
+	if !IsModule(object) {
+		runTimeError("Only modules have properties.")
+		return Value{}, false
+	}
+
+	value, ok := AsModule(object).Constants[name]
+	if !ok {
+		runTimeError("Undefined property '%s'.", name)
+		return Value{}, false
+	}
+
+	return value, true
+}
+
+// numberArg converts argument of module function to float64. position
+// is counted from 1 for the error message
+func numberArg(name string, args []Value, position int) (float64, bool) {
+	arg := args[position-1]
+	if !isNumeric(arg) {
+		runTimeError("Argument %d of '%s' must be a number.", position, name)
+		return 0, false
+	}
+
+	return toFloat(arg), true
+}
+
+// intArg returns integer argument of module function
+func intArg(name string, args []Value, position int) (int64, bool) {
+	arg := args[position-1]
+	if !IsInt(arg) {
+		runTimeError("Argument %d of '%s' must be an integer.", position, name)
+		return 0, false
+	}
+
+	return AsInt(arg), true
+}
+
+// stringArg returns string argument of module function
+func stringArg(name string, args []Value, position int) (string, bool) {
+	arg := args[position-1]
+	if !IsString(arg) {
+		runTimeError("Argument %d of '%s' must be a string.", position, name)
+		return "", false
+	}
+
+	return AsString(arg), true
+}
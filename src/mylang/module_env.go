@@ -0,0 +1,72 @@
+package main
+
+// module_env.go is the env module, the script arguments and exit
+
+import "os"
+
+var envModule = &ModuleObject{
+	Name: "env",
+	Functions: map[string]NativeMethod{
+		"get": envGet,
+	},
+	Constants: map[string]Value{},
+}
+
+var exitNative = &NativeFunction{Name: "exit", Function: exitFunction}
+
+// SetArgs sets the args global and env.args to the arguments given to
+// the script
+func SetArgs(args []string) {
+	items := []Value{}
+	for _, arg := range args {
+		items = append(items, StringVal(arg))
+	}
+
+	builtins["args"] = ListVal(items)
+	envModule.Constants["args"] = builtins["args"]
+}
+
+// get(name) returns the environment variable, or nil if it isn't set
+func envGet(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("env.get", args, 1, 1) {
+		return Value{}, false
+	}
+
+	name, ok := stringArg("env.get", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	if !vm.Permissions.Env {
+		runTimeError("Permission denied to read environment variable '%s'. Allow it with --allow-env.", name)
+		return Value{}, false
+	}
+
+	value, found := os.LookupEnv(name)
+	if !found {
+		return NilVal(), true
+	}
+	return StringVal(value), true
+}
+
+// exit([code]) stops the program with the exit code, 0 by default.
+// The finally blocks around the call are run first, but catch blocks
+// can't stop it
+func exitFunction(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("exit", args, 0, 1) {
+		return Value{}, false
+	}
+
+	code := int64(0)
+	if len(args) == 1 {
+		if !IsInt(args[0]) || AsInt(args[0]) < 0 || AsInt(args[0]) > 255 {
+			runTimeError("Exit code must be an integer from 0 to 255.")
+			return Value{}, false
+		}
+		code = AsInt(args[0])
+	}
+
+	// Returning false makes the run loop throw exitSignal
+	vm.Exception = exitSignal
+	vm.ExitCode = int(code)
+	return Value{}, false
+}
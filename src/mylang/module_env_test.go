@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExitRunsFinallyBlocks(t *testing.T) {
+	tests := []struct {
+		Source string
+		Output string
+		Result int
+		Code   int
+	}{
+		{`exit(5)`, "", InterpretExit, 5},
+		{`exit(args == env.args ? 6 : 7)`, "", InterpretExit, 6},
+		{`try { exit(3) } catch (e) { io.write("caught") } finally { io.write("cleanup") }`,
+			"cleanup", InterpretExit, 3},
+		{`try { try { exit(2) } finally { io.write("a") } } finally { io.write("b") }`,
+			"ab", InterpretExit, 2},
+		{`try { exit(1) } finally { try { throw 0 } catch (e) { io.write("caught") } }`,
+			"caught", InterpretExit, 1},
+		{`try { exit(1) } finally { exit(4) }`, "", InterpretExit, 4},
+		{`try { exit(1) } catch { 0 } finally { io.write("cleanup") }`, "cleanup", InterpretExit, 1},
+		{`try { try { exit(1) } catch (e) { 0 } } catch (e) { 0 }`, "", InterpretExit, 1},
+		{`try { exit(1) } finally { throw "error" }`,
+			"Uncaught exception: error\n[line 1:27] in script\n", InterpretRuntimeError, 1},
+		// The finally blocks of tries in a skipped catch block don't run
+		{`try { try { exit(3) } finally { io.write("a") } } catch { try { 1 } finally { io.write("b") } }`,
+			"a", InterpretExit, 3},
+		{`try { try { exit(8) } catch (e) { io.write("c") } finally { io.write("f") } } catch (e) { io.write("c") }`,
+			"f", InterpretExit, 8},
+		{`try { exit(1) } catch { true ? io.write("c") : 0 }`, "", InterpretExit, 1},
+		// Exit from catch and finally blocks
+		{`try { throw 0 } catch { exit(2) } finally { io.write("f") }`, "f", InterpretExit, 2},
+		{`try { throw 0 } catch { exit(2) }`, "", InterpretExit, 2},
+		{`try { throw 0 } catch { try { exit(6) } finally { io.write("a") } } finally { io.write("b") }`,
+			"ab", InterpretExit, 6},
+		{`try { throw 0 } catch { try { 1 } finally { exit(7) } } finally { io.write("b") }`,
+			"b", InterpretExit, 7},
+		{`try { 1 } finally { exit(5) }`, "", InterpretExit, 5},
+	}
+
+	for _, test := range tests {
+		for _, level := range []int{0, 1} {
+			OptimizationLevel = level
+			var result int
+			output := captureOutput(t, func() {
+				result = vm.Interpret(strings.NewReader(test.Source))
+			})
+
+			if output != test.Output || result != test.Result {
+				t.Errorf("%s at -O%d printed %q and returned %d, want %q and %d",
+					test.Source, level, output, result, test.Output, test.Result)
+			}
+			if result == InterpretExit && vm.ExitCode != test.Code {
+				t.Errorf("%s at -O%d exited with %d, want %d", test.Source, level, vm.ExitCode, test.Code)
+			}
+		}
+	}
+	OptimizationLevel = 1
+}
@@ -0,0 +1,213 @@
+package main
+
+// module_fs.go is the fs module for files and the io module for the
+// standard streams. Files can only be used in the directories allowed
+// by vm.Permissions
+
+import (
+	"bufio"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+var fsModule = &ModuleObject{
+	Name: "fs",
+	Functions: map[string]NativeMethod{
+		"read":   fsRead,
+		"write":  fsWriter("write", os.O_TRUNC),
+		"append": fsWriter("append", os.O_APPEND),
+		"exists": fsExists,
+		"list":   fsList,
+		"remove": fsRemove,
+	},
+	Constants: map[string]Value{},
+}
+
+var ioModule = &ModuleObject{
+	Name: "io",
+	Functions: map[string]NativeMethod{
+		"readLine": ioReadLine,
+		"write":    ioWrite,
+	},
+	Constants: map[string]Value{},
+}
+
+// DefaultWriteMode is the mode of files created by fs.write
+var DefaultWriteMode os.FileMode = 0644
+
+// stdin is read by io.readLine. It's created on the first read
+var stdin *bufio.Reader
+
+// read(path) returns the content of the file
+func fsRead(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("fs.read", args, 1, 1) {
+		return Value{}, false
+	}
+
+	path, ok := stringArg("fs.read", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	resolved, ok := checkAccess(path, vm.Permissions.Read, "read")
+	if !ok {
+		return Value{}, false
+	}
+
+	content, err := ioutil.ReadFile(resolved)
+	if err != nil {
+		runTimeError("Can't read '%s': %s.", path, pathErrorReason(err))
+		return Value{}, false
+	}
+	return StringVal(string(content)), true
+}
+
+// fsWriter creates write(path, content) and append(path, content).
+// mode is added to the flags that open the file
+func fsWriter(name string, mode int) NativeMethod {
+	name = "fs." + name
+	return func(receiver Value, args []Value) (Value, bool) {
+		if !checkArity(name, args, 2, 2) {
+			return Value{}, false
+		}
+
+		path, ok := stringArg(name, args, 1)
+		if !ok {
+			return Value{}, false
+		}
+		content, ok := stringArg(name, args, 2)
+		if !ok {
+			return Value{}, false
+		}
+		resolved, ok := checkAccess(path, vm.Permissions.Write, "write")
+		if !ok {
+			return Value{}, false
+		}
+
+		file, err := os.OpenFile(resolved, os.O_WRONLY|os.O_CREATE|mode, DefaultWriteMode)
+		if err == nil {
+			_, err = file.WriteString(content)
+			if closeErr := file.Close(); err == nil {
+				err = closeErr
+			}
+		}
+		if err != nil {
+			runTimeError("Can't write '%s': %s.", path, pathErrorReason(err))
+			return Value{}, false
+		}
+		return NilVal(), true
+	}
+}
+
+// exists(path) tells if the file or directory exists
+func fsExists(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("fs.exists", args, 1, 1) {
+		return Value{}, false
+	}
+
+	path, ok := stringArg("fs.exists", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	resolved, err := allowedPath(path, vm.Permissions.Read, resolvePath)
+	if os.IsNotExist(err) || err == errBrokenLink {
+		return BoolVal(false), true
+	}
+	if !reportAccess(path, "read", err) {
+		return Value{}, false
+	}
+
+	_, err = os.Stat(resolved)
+	return BoolVal(err == nil), true
+}
+
+// list(dir) returns the sorted names in the directory
+func fsList(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("fs.list", args, 1, 1) {
+		return Value{}, false
+	}
+
+	path, ok := stringArg("fs.list", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	resolved, ok := checkAccess(path, vm.Permissions.Read, "read")
+	if !ok {
+		return Value{}, false
+	}
+
+	file, err := os.Open(resolved)
+	if err != nil {
+		runTimeError("Can't list '%s': %s.", path, pathErrorReason(err))
+		return Value{}, false
+	}
+	names, err := file.Readdirnames(-1)
+	file.Close()
+	if err != nil {
+		runTimeError("Can't list '%s': %s.", path, pathErrorReason(err))
+		return Value{}, false
+	}
+
+	sort.Strings(names)
+	items := []Value{}
+	for _, name := range names {
+		items = append(items, StringVal(name))
+	}
+	return ListVal(items), true
+}
+
+// remove(path) removes the file or empty directory. Symlink is removed
+// and not the file it points to, so only the directory of the link
+// needs to be allowed
+func fsRemove(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("fs.remove", args, 1, 1) {
+		return Value{}, false
+	}
+
+	path, ok := stringArg("fs.remove", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	resolved, err := allowedPath(path, vm.Permissions.Write, resolveLink)
+	if !reportAccess(path, "write", err) {
+		return Value{}, false
+	}
+
+	if err := os.Remove(resolved); err != nil {
+		runTimeError("Can't remove '%s': %s.", path, pathErrorReason(err))
+		return Value{}, false
+	}
+	return NilVal(), true
+}
+
+// readLine() returns the next line from standard input without the line
+// break, or nil at the end of input
+func ioReadLine(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("io.readLine", args, 0, 0) {
+		return Value{}, false
+	}
+
+	if stdin == nil {
+		stdin = bufio.NewReader(os.Stdin)
+	}
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		return NilVal(), true
+	}
+
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return StringVal(line), true
+}
+
+// write(value) prints the value to standard output without line break
+func ioWrite(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("io.write", args, 1, 1) {
+		return Value{}, false
+	}
+
+	os.Stdout.WriteString(FormatValue(args[0]))
+	return NilVal(), true
+}
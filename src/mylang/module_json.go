@@ -0,0 +1,289 @@
+package main
+
+// module_json.go is the json module. JSON objects are maps with string
+// keys in the order of the source, arrays are lists and numbers are
+// integers unless they have fraction or exponent
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var jsonModule = &ModuleObject{
+	Name: "json",
+	Functions: map[string]NativeMethod{
+		"parse":     jsonParse,
+		"stringify": jsonStringify,
+	},
+	Constants: map[string]Value{},
+}
+
+// parse(s) converts JSON text to value
+func jsonParse(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("json.parse", args, 1, 1) {
+		return Value{}, false
+	}
+
+	text, ok := stringArg("json.parse", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+
+	value, err := decodeJSON(decoder)
+	if err == nil {
+		// Only one value is allowed
+		if _, err = decoder.Token(); err == nil {
+			err = errJSONTrailing
+		} else if err == io.EOF {
+			err = nil
+		}
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		runTimeError("Invalid JSON: %s.", err)
+		return Value{}, false
+	}
+	return value, true
+}
+
+// jsonError is error found by decodeJSON itself
+type jsonError string
+
+func (err jsonError) Error() string {
+	return string(err)
+}
+
+const errJSONTrailing = jsonError("unexpected data after value")
+
+// decodeJSON reads the next value from the decoder. The tokens are read
+// one by one to keep the order of object keys
+func decodeJSON(decoder *json.Decoder) (Value, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return Value{}, err
+	}
+
+	switch token := token.(type) {
+	case json.Delim:
+		if token == '[' {
+			return decodeJSONArray(decoder)
+		}
+		return decodeJSONObject(decoder)
+	case json.Number:
+		return jsonNumber(token)
+	case string:
+		return StringVal(token), nil
+	case bool:
+		return BoolVal(token), nil
+	default:
+		return NilVal(), nil
+	}
+}
+
+func decodeJSONArray(decoder *json.Decoder) (Value, error) {
+	items := []Value{}
+	for decoder.More() {
+		item, err := decodeJSON(decoder)
+		if err != nil {
+			return Value{}, err
+		}
+		items = append(items, item)
+	}
+
+	// Closing ]
+	if _, err := decoder.Token(); err != nil {
+		return Value{}, err
+	}
+	return ListVal(items), nil
+}
+
+func decodeJSONObject(decoder *json.Decoder) (Value, error) {
+	object := NewMapObject()
+	for decoder.More() {
+		// The decoder only gives strings as keys
+		key, err := decoder.Token()
+		if err != nil {
+			return Value{}, err
+		}
+		value, err := decodeJSON(decoder)
+		if err != nil {
+			return Value{}, err
+		}
+		object.Set(StringVal(key.(string)), value)
+	}
+
+	// Closing }
+	if _, err := decoder.Token(); err != nil {
+		return Value{}, err
+	}
+	return MapVal(object), nil
+}
+
+// jsonNumber converts the number to integer, or to float if it has
+// fraction or exponent or doesn't fit in int64
+func jsonNumber(number json.Number) (Value, error) {
+	text := string(number)
+	if !strings.ContainsAny(text, ".eE") {
+		if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return IntVal(i), nil
+		}
+	}
+
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return Value{}, jsonError("number " + text + " is out of range")
+	}
+	return NumberVal(f), nil
+}
+
+// stringify(value, [indent]) converts the value to JSON text. indent is
+// the number of spaces or the string used for each level. Without it
+// the text is on one line
+func jsonStringify(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("json.stringify", args, 1, 2) {
+		return Value{}, false
+	}
+
+	indent := ""
+	if len(args) == 2 {
+		switch {
+		case IsInt(args[1]) && AsInt(args[1]) >= 0 && AsInt(args[1]) <= 10:
+			indent = strings.Repeat(" ", int(AsInt(args[1])))
+		case IsString(args[1]):
+			indent = AsString(args[1])
+		default:
+			runTimeError("Argument 2 of 'json.stringify' must be a string or an integer from 0 to 10.")
+			return Value{}, false
+		}
+	}
+
+	encoder := jsonEncoder{Indent: indent, Encoding: map[interface{}]bool{}}
+	if !encoder.encode(args[0], 0) {
+		return Value{}, false
+	}
+	return StringVal(encoder.Text.String()), true
+}
+
+// jsonEncoder writes values as JSON to Text
+type jsonEncoder struct {
+	Text   strings.Builder
+	Indent string
+	// Encoding has the lists and maps that are being encoded. Finding
+	// one of them again means the value contains itself
+	Encoding map[interface{}]bool
+}
+
+func (e *jsonEncoder) encode(value Value, depth int) bool {
+	switch value.Type {
+	case ValNil:
+		e.Text.WriteString("null")
+	case ValBool, ValInt:
+		e.Text.WriteString(FormatValue(value))
+	case ValNumber:
+		// formatFloat gives valid JSON for finite numbers
+		number := AsNumber(value)
+		if math.IsNaN(number) || math.IsInf(number, 0) {
+			runTimeError("Can't convert %s to JSON.", FormatValue(value))
+			return false
+		}
+		e.Text.WriteString(formatFloat(number))
+	case ValString:
+		e.writeString(AsString(value))
+	case ValList:
+		list := AsList(value)
+		if !e.begin(list) {
+			return false
+		}
+		e.Text.WriteByte('[')
+		for i, item := range list.Items {
+			e.separator(i, depth+1)
+			if !e.encode(item, depth+1) {
+				return false
+			}
+		}
+		e.end(len(list.Items), depth, ']')
+		delete(e.Encoding, list)
+	case ValMap:
+		object := AsMap(value)
+		if !e.begin(object) {
+			return false
+		}
+		e.Text.WriteByte('{')
+		for i, entry := range object.Entries {
+			if !IsString(entry.Key) {
+				runTimeError("Can't convert map key %s to JSON. Keys must be strings.", formatItem(entry.Key, map[interface{}]bool{}))
+				return false
+			}
+			e.separator(i, depth+1)
+			e.writeString(AsString(entry.Key))
+			e.Text.WriteByte(':')
+			if e.Indent != "" {
+				e.Text.WriteByte(' ')
+			}
+			if !e.encode(entry.Value, depth+1) {
+				return false
+			}
+		}
+		e.end(len(object.Entries), depth, '}')
+		delete(e.Encoding, object)
+	default:
+		runTimeError("Can't convert %s to JSON.", FormatValue(value))
+		return false
+	}
+
+	return true
+}
+
+// begin marks list or map as being encoded. Reports error if it already
+// is
+func (e *jsonEncoder) begin(object interface{}) bool {
+	if e.Encoding[object] {
+		runTimeError("Can't convert cyclic value to JSON.")
+		return false
+	}
+
+	e.Encoding[object] = true
+	return true
+}
+
+// separator writes what comes before item i at depth
+func (e *jsonEncoder) separator(i int, depth int) {
+	if i > 0 {
+		e.Text.WriteByte(',')
+	}
+	e.newline(depth)
+}
+
+// end closes list or map of count items
+func (e *jsonEncoder) end(count int, depth int, closing byte) {
+	if count > 0 {
+		e.newline(depth)
+	}
+	e.Text.WriteByte(closing)
+}
+
+func (e *jsonEncoder) newline(depth int) {
+	if e.Indent != "" {
+		e.Text.WriteByte('\n')
+		e.Text.WriteString(strings.Repeat(e.Indent, depth))
+	}
+}
+
+// writeString writes JSON string. < > and & are not escaped
+func (e *jsonEncoder) writeString(s string) {
+	var buffer bytes.Buffer
+	encoder := json.NewEncoder(&buffer)
+	encoder.SetEscapeHTML(false)
+	// Strings always encode
+	encoder.Encode(s)
+	e.Text.Write(bytes.TrimSuffix(buffer.Bytes(), []byte("\n")))
+}
@@ -0,0 +1,199 @@
+package main
+
+// module_math.go is the math module
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+var mathModule = &ModuleObject{
+	Name: "math",
+	Functions: map[string]NativeMethod{
+		"sqrt":   mathFunction("sqrt", math.Sqrt),
+		"floor":  mathRounding("floor", math.Floor),
+		"ceil":   mathRounding("ceil", math.Ceil),
+		"round":  mathRounding("round", math.Round),
+		"abs":    mathAbs,
+		"pow":    mathPow,
+		"min":    mathMin,
+		"max":    mathMax,
+		"sin":    mathFunction("sin", math.Sin),
+		"cos":    mathFunction("cos", math.Cos),
+		"tan":    mathFunction("tan", math.Tan),
+		"asin":   mathFunction("asin", math.Asin),
+		"acos":   mathFunction("acos", math.Acos),
+		"atan":   mathFunction("atan", math.Atan),
+		"atan2":  mathAtan2,
+		"log":    mathFunction("log", math.Log),
+		"exp":    mathFunction("exp", math.Exp),
+		"random": mathRandom,
+		"seed":   mathSeed,
+	},
+	Constants: map[string]Value{
+		"pi":  NumberVal(math.Pi),
+		"e":   NumberVal(math.E),
+		"inf": NumberVal(math.Inf(1)),
+		"nan": NumberVal(math.NaN()),
+	},
+}
+
+// random is the generator of math.random. It starts from the time so
+// that each run gets different numbers. math.seed makes them repeatable
+var random = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// mathFunction wraps float function of one argument
+func mathFunction(name string, function func(float64) float64) NativeMethod {
+	name = "math." + name
+	return func(receiver Value, args []Value) (Value, bool) {
+		if !checkArity(name, args, 1, 1) {
+			return Value{}, false
+		}
+
+		x, ok := numberArg(name, args, 1)
+		if !ok {
+			return Value{}, false
+		}
+
+		return NumberVal(function(x)), true
+	}
+}
+
+// mathRounding wraps rounding function. Integers are returned as they
+// are and floats are rounded to integer if it fits in int64
+func mathRounding(name string, function func(float64) float64) NativeMethod {
+	name = "math." + name
+	return func(receiver Value, args []Value) (Value, bool) {
+		if !checkArity(name, args, 1, 1) {
+			return Value{}, false
+		}
+
+		if IsInt(args[0]) {
+			return args[0], true
+		}
+		x, ok := numberArg(name, args, 1)
+		if !ok {
+			return Value{}, false
+		}
+
+		rounded := function(x)
+		// -2^63 is exact in float64 but 2^63 is past the range
+		if rounded >= math.MinInt64 && rounded < math.MaxInt64 {
+			return IntVal(int64(rounded)), true
+		}
+		return NumberVal(rounded), true
+	}
+}
+
+// abs(x) returns the absolute value keeping the type of x
+func mathAbs(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("math.abs", args, 1, 1) {
+		return Value{}, false
+	}
+
+	if !IsInt(args[0]) {
+		x, ok := numberArg("math.abs", args, 1)
+		if !ok {
+			return Value{}, false
+		}
+		return NumberVal(math.Abs(x)), true
+	}
+
+	x := AsInt(args[0])
+	if x >= 0 {
+		return args[0], true
+	}
+	result, err := unaryArithmetic(OpNegate, args[0])
+	if err != nil {
+		runTimeError("%s", err)
+		return Value{}, false
+	}
+	return result, true
+}
+
+// pow(x, y) is x ** y
+func mathPow(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("math.pow", args, 2, 2) {
+		return Value{}, false
+	}
+
+	result, err := arithmetic(OpPower, args[0], args[1])
+	if err != nil {
+		runTimeError("%s", err)
+		return Value{}, false
+	}
+	return result, true
+}
+
+// min(x, ...) returns the smallest argument
+func mathMin(receiver Value, args []Value) (Value, bool) {
+	return mathExtreme("math.min", args, OpLess)
+}
+
+// max(x, ...) returns the largest argument
+func mathMax(receiver Value, args []Value) (Value, bool) {
+	return mathExtreme("math.max", args, OpGreater)
+}
+
+// mathExtreme returns the argument that wins the comparison against
+// all the others. The first one wins ties
+func mathExtreme(name string, args []Value, op uint8) (Value, bool) {
+	if !checkArity(name, args, 1, math.MaxUint8) {
+		return Value{}, false
+	}
+
+	result := args[0]
+	for i := range args {
+		if _, ok := numberArg(name, args, i+1); !ok {
+			return Value{}, false
+		}
+
+		better, _ := arithmetic(op, args[i], result)
+		if AsBool(better) {
+			result = args[i]
+		}
+	}
+	return result, true
+}
+
+// atan2(y, x) returns the angle of the point (x, y)
+func mathAtan2(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("math.atan2", args, 2, 2) {
+		return Value{}, false
+	}
+
+	y, ok := numberArg("math.atan2", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	x, ok := numberArg("math.atan2", args, 2)
+	if !ok {
+		return Value{}, false
+	}
+	return NumberVal(math.Atan2(y, x)), true
+}
+
+// random() returns float from 0 up to but not including 1
+func mathRandom(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("math.random", args, 0, 0) {
+		return Value{}, false
+	}
+
+	return NumberVal(random.Float64()), true
+}
+
+// seed(n) restarts math.random from integer seed
+func mathSeed(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("math.seed", args, 1, 1) {
+		return Value{}, false
+	}
+
+	seed, ok := intArg("math.seed", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+
+	random.Seed(seed)
+	return NilVal(), true
+}
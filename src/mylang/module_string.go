@@ -0,0 +1,178 @@
+package main
+
+// module_string.go is the string module. Lengths and positions count
+// characters, not bytes
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+var stringModule = &ModuleObject{
+	Name: "string",
+	Functions: map[string]NativeMethod{
+		"len":     stringLen,
+		"upper":   stringFunction("upper", strings.ToUpper),
+		"lower":   stringFunction("lower", strings.ToLower),
+		"trim":    stringFunction("trim", strings.TrimSpace),
+		"split":   stringSplit,
+		"join":    stringJoin,
+		"replace": stringReplace,
+		"find":    stringFind,
+		"substr":  stringSubstr,
+	},
+	Constants: map[string]Value{},
+}
+
+// stringFunction wraps string function of one argument
+func stringFunction(name string, function func(string) string) NativeMethod {
+	name = "string." + name
+	return func(receiver Value, args []Value) (Value, bool) {
+		if !checkArity(name, args, 1, 1) {
+			return Value{}, false
+		}
+
+		s, ok := stringArg(name, args, 1)
+		if !ok {
+			return Value{}, false
+		}
+
+		return StringVal(function(s)), true
+	}
+}
+
+// len(s) returns the number of characters
+func stringLen(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.len", args, 1, 1) {
+		return Value{}, false
+	}
+
+	s, ok := stringArg("string.len", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+
+	return IntVal(int64(utf8.RuneCountInString(s))), true
+}
+
+// split(s, separator) returns list of the parts between separators.
+// Empty separator splits to characters
+func stringSplit(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.split", args, 2, 2) {
+		return Value{}, false
+	}
+
+	s, ok := stringArg("string.split", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	separator, ok := stringArg("string.split", args, 2)
+	if !ok {
+		return Value{}, false
+	}
+
+	items := []Value{}
+	for _, part := range strings.Split(s, separator) {
+		items = append(items, StringVal(part))
+	}
+	return ListVal(items), true
+}
+
+// join(list, separator) joins the values of list with separator.
+// Values that are not strings are formatted like print
+func stringJoin(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.join", args, 2, 2) {
+		return Value{}, false
+	}
+
+	if !IsList(args[0]) {
+		runTimeError("Argument 1 of 'string.join' must be a list.")
+		return Value{}, false
+	}
+	separator, ok := stringArg("string.join", args, 2)
+	if !ok {
+		return Value{}, false
+	}
+
+	parts := []string{}
+	for _, item := range AsList(args[0]).Items {
+		parts = append(parts, FormatValue(item))
+	}
+	return StringVal(strings.Join(parts, separator)), true
+}
+
+// replace(s, old, new) replaces all old in s with new
+func stringReplace(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.replace", args, 3, 3) {
+		return Value{}, false
+	}
+
+	strs := [3]string{}
+	for i := range strs {
+		s, ok := stringArg("string.replace", args, i+1)
+		if !ok {
+			return Value{}, false
+		}
+		strs[i] = s
+	}
+
+	return StringVal(strings.ReplaceAll(strs[0], strs[1], strs[2])), true
+}
+
+// find(s, sub) returns the position of the first sub in s, or -1
+func stringFind(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.find", args, 2, 2) {
+		return Value{}, false
+	}
+
+	s, ok := stringArg("string.find", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	sub, ok := stringArg("string.find", args, 2)
+	if !ok {
+		return Value{}, false
+	}
+
+	index := strings.Index(s, sub)
+	if index < 0 {
+		return IntVal(-1), true
+	}
+	return IntVal(int64(utf8.RuneCountInString(s[:index]))), true
+}
+
+// substr(s, start, [length]) returns length characters from start, or
+// the rest of s. Negative start counts from the end like list indexes
+// and the bounds are clamped like list slices
+func stringSubstr(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("string.substr", args, 2, 3) {
+		return Value{}, false
+	}
+
+	s, ok := stringArg("string.substr", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	chars := []rune(s)
+	if _, ok := intArg("string.substr", args, 2); !ok {
+		return Value{}, false
+	}
+	start, _ := sliceBound(args[1], len(chars))
+
+	end := len(chars)
+	if len(args) == 3 {
+		length, ok := intArg("string.substr", args, 3)
+		if !ok {
+			return Value{}, false
+		}
+		if length < 0 {
+			runTimeError("Substring length must not be negative.")
+			return Value{}, false
+		}
+		if length < int64(end-start) {
+			end = start + int(length)
+		}
+	}
+
+	return StringVal(string(chars[start:end])), true
+}
@@ -0,0 +1,95 @@
+package main
+
+// module_time.go is the time module. Times are seconds as floats
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+var timeModule = &ModuleObject{
+	Name: "time",
+	Functions: map[string]NativeMethod{
+		"clock":  timeClock,
+		"now":    timeNow,
+		"format": timeFormat,
+	},
+	Constants: map[string]Value{},
+}
+
+// startTime is the zero of time.clock
+var startTime = time.Now()
+
+// clock() returns seconds since the program started. It isn't affected
+// by changes to the system clock, so it's for measuring durations
+func timeClock(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("time.clock", args, 0, 0) {
+		return Value{}, false
+	}
+
+	return NumberVal(time.Since(startTime).Seconds()), true
+}
+
+// now() returns seconds since 1970-01-01 UTC
+func timeNow(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("time.now", args, 0, 0) {
+		return Value{}, false
+	}
+
+	return NumberVal(float64(time.Now().UnixNano()) / float64(time.Second)), true
+}
+
+// format(t, layout) formats time t from time.now in local time. Layout
+// has %Y year, %m month, %d day, %H hour, %M minute, %S second and %%
+func timeFormat(receiver Value, args []Value) (Value, bool) {
+	if !checkArity("time.format", args, 2, 2) {
+		return Value{}, false
+	}
+
+	seconds, ok := numberArg("time.format", args, 1)
+	if !ok {
+		return Value{}, false
+	}
+	layout, ok := stringArg("time.format", args, 2)
+	if !ok {
+		return Value{}, false
+	}
+
+	t := time.Unix(0, int64(seconds*float64(time.Second))).Local()
+	var builder strings.Builder
+	for i := 0; i < len(layout); i++ {
+		if layout[i] != '%' {
+			builder.WriteByte(layout[i])
+			continue
+		}
+
+		i++
+		if i == len(layout) {
+			runTimeError("Time layout ends with '%%'.")
+			return Value{}, false
+		}
+
+		switch layout[i] {
+		case 'Y':
+			fmt.Fprintf(&builder, "%04d", t.Year())
+		case 'm':
+			fmt.Fprintf(&builder, "%02d", int(t.Month()))
+		case 'd':
+			fmt.Fprintf(&builder, "%02d", t.Day())
+		case 'H':
+			fmt.Fprintf(&builder, "%02d", t.Hour())
+		case 'M':
+			fmt.Fprintf(&builder, "%02d", t.Minute())
+		case 'S':
+			fmt.Fprintf(&builder, "%02d", t.Second())
+		case '%':
+			builder.WriteByte('%')
+		default:
+			runTimeError("Unknown time format '%%%c'.", layout[i])
+			return Value{}, false
+		}
+	}
+
+	return StringVal(builder.String()), true
+}
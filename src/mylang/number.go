@@ -0,0 +1,133 @@
+package main
+
+// number.go converts number literals to values.
+// Supported forms are decimal numbers with optional fraction and exponent
+// (1, 1.5, 1.5e-3) and integers with base prefix (0xFF, 0b1010, 0o17).
+// Digits can be separated with '_' (1_000_000).
+// Literals without fraction or exponent are integers, others are floats
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+var errMalformedNumber = errors.New("Malformed number literal")
+var errNumberRange = errors.New("Number literal out of range")
+
+// parseNumberLiteral parses the text of TokenNumber
+func parseNumberLiteral(text string) (Value, error) {
+	base := 10
+	digits := text
+	if len(text) > 2 && text[0] == '0' {
+		switch text[1] {
+		case 'x', 'X':
+			base = 16
+		case 'b', 'B':
+			base = 2
+		case 'o', 'O':
+			base = 8
+		}
+	}
+	if base != 10 {
+		digits = text[2:]
+	}
+
+	if !validSeparators(digits, base) {
+		return Value{}, errMalformedNumber
+	}
+	digits = strings.Replace(digits, "_", "", -1)
+
+	if base == 10 && !validDecimal(digits) {
+		return Value{}, errMalformedNumber
+	}
+
+	if base != 10 || !strings.ContainsAny(digits, ".eE") {
+		value, err := strconv.ParseInt(digits, base, 64)
+		return IntVal(value), numberError(err)
+	}
+
+	value, err := strconv.ParseFloat(digits, 64)
+	return NumberVal(value), numberError(err)
+}
+
+// numberError converts the strconv error to compile error message
+func numberError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if numErr, ok := err.(*strconv.NumError); ok && numErr.Err == strconv.ErrRange {
+		return errNumberRange
+	}
+
+	return errMalformedNumber
+}
+
+// validSeparators checks that every '_' is between two digits
+func validSeparators(digits string, base int) bool {
+	for i := 0; i < len(digits); i++ {
+		if digits[i] != '_' {
+			continue
+		}
+
+		if i == 0 || i == len(digits)-1 ||
+			!isBaseDigit(rune(digits[i-1]), base) || !isBaseDigit(rune(digits[i+1]), base) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// validDecimal checks the form digits[.digits][(e|E)[+|-]digits].
+// ParseFloat accepts more, like "inf" and hex floats
+func validDecimal(text string) bool {
+	i := skipDigits(text, 0)
+	if i == 0 {
+		return false
+	}
+
+	if i < len(text) && text[i] == '.' {
+		end := skipDigits(text, i+1)
+		if end == i+1 {
+			return false
+		}
+		i = end
+	}
+
+	if i < len(text) && (text[i] == 'e' || text[i] == 'E') {
+		i++
+		if i < len(text) && (text[i] == '+' || text[i] == '-') {
+			i++
+		}
+		end := skipDigits(text, i)
+		if end == i {
+			return false
+		}
+		i = end
+	}
+
+	return i == len(text)
+}
+
+func skipDigits(text string, start int) int {
+	for start < len(text) && isDigit(rune(text[start])) {
+		start++
+	}
+
+	return start
+}
+
+func isBaseDigit(c rune, base int) bool {
+	switch base {
+	case 2:
+		return c == '0' || c == '1'
+	case 8:
+		return c >= '0' && c <= '7'
+	case 16:
+		return isDigit(c) || (c >= 'a' && c <= 'f') || (c >= 'A' && c <= 'F')
+	default:
+		return isDigit(c)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import "testing"
+
+func TestParseNumberLiteral(t *testing.T) {
+	// Values are formatted, so integers print without fraction
+	tests := []struct {
+		Text  string
+		Value string
+	}{
+		{"0", "0"},
+		{"007", "7"},
+		{"1_000_000", "1000000"},
+		{"0xff", "255"},
+		{"0XFF", "255"},
+		{"0b1010", "10"},
+		{"0B11", "3"},
+		{"0o17", "15"},
+		{"0x7fff_ffff_ffff_ffff", "9223372036854775807"},
+		{"9223372036854775807", "9223372036854775807"},
+		{"1.5", "1.5"},
+		{"1_0.2_5", "10.25"},
+		{"1e3", "1000.0"},
+		{"1E3", "1000.0"},
+		{"1.5e-3", "0.0015"},
+		{"2e+2", "200.0"},
+		// Underflow rounds to zero like in Go
+		{"1e-400", "0.0"},
+	}
+
+	for _, test := range tests {
+		value, err := parseNumberLiteral(test.Text)
+		if err != nil {
+			t.Errorf("%s: %v", test.Text, err)
+			continue
+		}
+		if FormatValue(value) != test.Value {
+			t.Errorf("%s is %s, want %s", test.Text, FormatValue(value), test.Value)
+		}
+	}
+}
+
+func TestParseNumberLiteralErrors(t *testing.T) {
+	tests := []struct {
+		Text string
+		Err  error
+	}{
+		{"0x", errMalformedNumber},
+		{"0b102", errMalformedNumber},
+		{"0o8", errMalformedNumber},
+		{"0xG", errMalformedNumber},
+		{"0x_1", errMalformedNumber},
+		{"1__0", errMalformedNumber},
+		{"1_", errMalformedNumber},
+		{"1_.5", errMalformedNumber},
+		{"1e", errMalformedNumber},
+		{"1e+", errMalformedNumber},
+		{"1.5e_3", errMalformedNumber},
+		{"1x", errMalformedNumber},
+		// ParseFloat accepts these but the scanner never makes them
+		{"inf", errMalformedNumber},
+		{"0x1p4", errMalformedNumber},
+		{"9223372036854775808", errNumberRange},
+		{"0x8000000000000000", errNumberRange},
+		{"1e400", errNumberRange},
+	}
+
+	for _, test := range tests {
+		if _, err := parseNumberLiteral(test.Text); err != test.Err {
+			t.Errorf("%s: got error %v, want %v", test.Text, err, test.Err)
+		}
+	}
+}
+
+func TestNumberLiteralCompileErrors(t *testing.T) {
+	checkCompileErrors(t, []errorProgram{
+		{Source: "1 + 0b", Output: "[line 1:5] Error at '0b': Malformed number literal\n"},
+		{Source: "[1, 2e]", Output: "[line 1:5] Error at '2e': Malformed number literal\n"},
+		{Source: "\n  0o8", Output: "[line 2:3] Error at '0o8': Malformed number literal\n"},
+		// The literal is parsed before it's negated
+		{Source: "-9223372036854775808", Output: "[line 1:2] Error at '9223372036854775808': Number literal out of range\n"},
+		{Source: "1e400", Output: "[line 1:1] Error at '1e400': Number literal out of range\n"},
+		// '.' without digits after it is property access
+		{Source: "1.", Output: "[line 1:3] Error at end: Expect property name after '.'\n"},
+		{Source: "_1", Output: "[line 1:1] Error at '_1': Undefined variable '_1'\n"},
+	})
+}
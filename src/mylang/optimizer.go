@@ -0,0 +1,459 @@
+package main
+
+// optimizer.go contains the peephole optimizer that is run over the chunk
+// after compiling. The chunk is decoded into a list of instructions,
+// rewritten and encoded back to bytes.
+// Constants are decoded as values and the constant table is built again
+// when encoding, so folding doesn't fill it with intermediate results.
+// Jump targets are decoded as labels, so the jumps can be encoded with
+// the right offsets after the code between has changed.
+
+// instruction is a single decoded bytecode instruction
+type instruction struct {
+	Op uint8
+	// Operand is the count for OpBuildString, OpBuildList,
+	// OpExtendList, OpBuildMap, OpExtendMap and OpCall, the flags for OpIndexIncrement, the slot for
+	// OpGetLocal and OpDefineLocal, the length for OpMatchList and the
+	// label for jumps and opLabel
+	Operand int
+	// Constant is the value of the constant operand of OpConstant,
+	// OpInvoke, OpJumpTable, OpGetGlobal and OpGetProperty
+	Constant Value
+	// ArgCount is the second operand of OpInvoke
+	ArgCount int
+	// Finally is the label of the finally block of OpTry, -1 if there
+	// is none
+	Finally int
+	// Targets are the labels of OpJumpTable, the default first
+	Targets []int
+	Line    int
+	Column  int
+}
+
+// opLabel is pseudo instruction that marks jump target. It isn't
+// encoded. Labels also keep the peephole rules from matching
+// instructions across them, as the values may come from either branch
+const opLabel uint8 = 0xff
+
+// Optimize folds constant expressions and replaces instruction sequences
+// with shorter ones. Program output stays the same
+func (chunk *Chunk) Optimize() {
+	code := peephole(chunk.decodeInstructions())
+
+	optimized := Chunk{}
+	optimized.InitChunk()
+	optimized.encodeInstructions(code)
+	// Folded results can be more constants than the code had
+	if optimized.Constants.Count <= MaxConstants {
+		*chunk = optimized
+	}
+}
+
+func (chunk *Chunk) decodeInstructions() []instruction {
+	code := []instruction{}
+
+	// Number the jump targets
+	labels := map[int]int{}
+	addLabel := func(target int) {
+		if _, ok := labels[target]; !ok {
+			labels[target] = len(labels)
+		}
+	}
+	for offset := 0; offset < chunk.Count; offset += chunk.instructionLength(offset) {
+		switch op := chunk.Code[offset]; {
+		case isJump(op):
+			addLabel(offset + 3 + chunk.readShort(offset+1))
+			if finally, ok := chunk.finallyTarget(offset); ok {
+				addLabel(finally)
+			}
+		case op == OpJumpTable:
+			for _, target := range chunk.tableTargets(offset) {
+				addLabel(target)
+			}
+		}
+	}
+
+	for offset := 0; offset <= chunk.Count; offset += chunk.instructionLength(offset) {
+		if label, ok := labels[offset]; ok {
+			code = append(code, instruction{Op: opLabel, Operand: label})
+		}
+		if offset == chunk.Count {
+			break
+		}
+
+		in := instruction{Op: chunk.Code[offset], Line: chunk.Lines[offset], Column: chunk.Columns[offset]}
+		switch {
+		case isJump(in.Op):
+			in.Operand = labels[offset+3+chunk.readShort(offset+1)]
+		case usesConstant(in.Op):
+			in.Constant = chunk.Constants.Values[chunk.Code[offset+1]]
+		case hasOperand(in.Op):
+			in.Operand = int(chunk.Code[offset+1])
+		}
+		if in.Op == OpInvoke {
+			in.ArgCount = int(chunk.Code[offset+2])
+		}
+		if in.Op == OpTry {
+			in.Finally = -1
+			if finally, ok := chunk.finallyTarget(offset); ok {
+				in.Finally = labels[finally]
+			}
+		}
+		if in.Op == OpJumpTable {
+			for _, target := range chunk.tableTargets(offset) {
+				in.Targets = append(in.Targets, labels[target])
+			}
+		}
+		code = append(code, in)
+	}
+
+	return code
+}
+
+func (chunk *Chunk) readShort(offset int) int {
+	return int(chunk.Code[offset])<<8 | int(chunk.Code[offset+1])
+}
+
+// finallyTarget returns the finally address of OpTry at offset. Returns
+// false if the instruction isn't OpTry or the try has no finally
+func (chunk *Chunk) finallyTarget(offset int) (int, bool) {
+	if chunk.Code[offset] != OpTry || chunk.readShort(offset+3) == 0 {
+		return 0, false
+	}
+	return offset + 5 + chunk.readShort(offset+3), true
+}
+
+// tableTargets returns the addresses of OpJumpTable at offset, the
+// default first
+func (chunk *Chunk) tableTargets(offset int) []int {
+	targets := make([]int, int(chunk.Code[offset+2])+1)
+	for i := range targets {
+		targets[i] = chunk.readShort(offset + 3 + 2*i)
+	}
+	return targets
+}
+
+// instructionLength returns the size of the instruction at offset.
+// The size of OpJumpTable depends on its table
+func (chunk *Chunk) instructionLength(offset int) int {
+	if chunk.Code[offset] == OpJumpTable {
+		return 3 + 2*(int(chunk.Code[offset+2])+1)
+	}
+	return instructionSize(chunk.Code[offset])
+}
+
+// encodeInstructions writes the instructions to the empty chunk. Only
+// the constants that the instructions use are added
+func (chunk *Chunk) encodeInstructions(code []instruction) {
+	// Find where the labels end up
+	positions := map[int]int{}
+	position := 0
+	for _, in := range code {
+		switch in.Op {
+		case opLabel:
+			positions[in.Operand] = position
+		case OpJumpTable:
+			position += 3 + 2*len(in.Targets)
+		default:
+			position += instructionSize(in.Op)
+		}
+	}
+
+	for _, in := range code {
+		if in.Op == opLabel {
+			continue
+		}
+
+		chunk.write(in.Op, in)
+		if isJump(in.Op) {
+			chunk.writeJump(positions[in.Operand], in)
+			if in.Op == OpTry && in.Finally < 0 {
+				chunk.write(0, in)
+				chunk.write(0, in)
+			} else if in.Op == OpTry {
+				chunk.writeJump(positions[in.Finally], in)
+			}
+			continue
+		}
+		if !hasOperand(in.Op) {
+			continue
+		}
+		if !usesConstant(in.Op) {
+			chunk.write(uint8(in.Operand), in)
+			continue
+		}
+
+		chunk.write(uint8(chunk.AddConstant(in.Constant)), in)
+
+		switch in.Op {
+		case OpInvoke:
+			chunk.write(uint8(in.ArgCount), in)
+		case OpJumpTable:
+			// Table has absolute addresses
+			chunk.write(uint8(len(in.Targets)-1), in)
+			for _, label := range in.Targets {
+				chunk.write(uint8(positions[label]>>8), in)
+				chunk.write(uint8(positions[label]), in)
+			}
+		}
+	}
+}
+
+// write writes byte of the instruction at its position
+func (chunk *Chunk) write(_byte uint8, in instruction) {
+	chunk.WriteChunk(_byte, in.Line, in.Column)
+}
+
+// writeJump writes the offset to target. Offset is from the end of the
+// offset itself
+func (chunk *Chunk) writeJump(target int, in instruction) {
+	jump := target - chunk.Count - 2
+	chunk.write(uint8(jump>>8), in)
+	chunk.write(uint8(jump), in)
+}
+
+// peephole appends the instructions one by one and after each one
+// reduces the end of the output as long as some rule matches.
+// This way folded results can be folded again: 1 + 2 * 3 becomes 7
+func peephole(code []instruction) []instruction {
+	out := []instruction{}
+
+	for _, in := range code {
+		out = append(out, in)
+		for {
+			reduced, ok := reduce(out)
+			if !ok {
+				break
+			}
+			out = reduced
+		}
+	}
+
+	return out
+}
+
+// reduce tries to rewrite the end of the code. Returns false if no rule matched
+func reduce(code []instruction) ([]instruction, bool) {
+	n := len(code)
+	if n < 2 {
+		return code, false
+	}
+
+	last := code[n-1]
+	prev := code[n-2]
+
+	// Drop jumps to the next instruction: OpJump L, label L
+	if last.Op == opLabel && prev.Op == OpJump && prev.Operand == last.Operand {
+		return append(code[:n-2], last), true
+	}
+
+	// Fold constant binary operations: OpConstant 1, OpConstant 2, OpAdd
+	if n >= 3 && isBinaryOp(last.Op) {
+		a, aOk := literalValue(code[n-3])
+		b, bOk := literalValue(prev)
+		if aOk && bOk {
+			if result, ok := foldBinary(last.Op, a, b); ok {
+				folded := literalInstruction(result, code[n-3])
+				return append(code[:n-3], folded), true
+			}
+		}
+	}
+
+	// Fold interpolations of constants: "${1 + 2}"
+	if last.Op == OpBuildString && n > last.Operand {
+		if folded, ok := foldBuildString(code[n-1-last.Operand:n-1], last); ok {
+			return append(code[:n-1-last.Operand], folded), true
+		}
+	}
+
+	// Fold constant unary operations: OpConstant 1, OpNegate
+	if value, ok := literalValue(prev); ok {
+		switch {
+		case last.Op == OpNot:
+			folded := literalInstruction(BoolVal(isFalsey(value)), prev)
+			return append(code[:n-2], folded), true
+		case last.Op == OpNegate || last.Op == OpBitNot:
+			if result, err := unaryArithmetic(last.Op, value); err == nil {
+				folded := literalInstruction(result, prev)
+				return append(code[:n-2], folded), true
+			}
+		}
+	}
+
+	// Invert comparisons instead of negating the result: OpLess, OpNot
+	if last.Op == OpNot {
+		if inverted, ok := invertComparison(prev.Op); ok {
+			prev.Op = inverted
+			return append(code[:n-2], prev), true
+		}
+	}
+
+	// Collapse double negations when the operand is known to already
+	// be of the right type, so no runtime errors are lost
+	if n >= 3 && last.Op == prev.Op {
+		if last.Op == OpNot && producesBool(code[n-3].Op) {
+			return code[:n-2], true
+		}
+		if last.Op == OpNegate && producesFloat(code[n-3]) {
+			return code[:n-2], true
+		}
+	}
+
+	return code, false
+}
+
+// foldBuildString joins the parts if they all are constants
+func foldBuildString(parts []instruction, at instruction) (instruction, bool) {
+	result := ""
+	for _, part := range parts {
+		value, ok := literalValue(part)
+		if !ok {
+			return instruction{}, false
+		}
+		result += FormatValue(value)
+	}
+
+	return literalInstruction(StringVal(result), at), true
+}
+
+// literalValue returns the value an instruction pushes if it's a constant
+func literalValue(in instruction) (Value, bool) {
+	switch in.Op {
+	case OpConstant:
+		return in.Constant, true
+	case OpNil:
+		return NilVal(), true
+	case OpTrue:
+		return BoolVal(true), true
+	case OpFalse:
+		return BoolVal(false), true
+	default:
+		return Value{}, false
+	}
+}
+
+// literalInstruction creates instruction that pushes the value. It gets
+// the position of at
+func literalInstruction(value Value, at instruction) instruction {
+	folded := instruction{Op: OpConstant, Line: at.Line, Column: at.Column}
+	switch {
+	case IsNil(value):
+		folded.Op = OpNil
+	case IsBool(value) && AsBool(value):
+		folded.Op = OpTrue
+	case IsBool(value):
+		folded.Op = OpFalse
+	default:
+		folded.Constant = value
+	}
+	return folded
+}
+
+// hasOperand tells if the instruction is followed by one byte operand.
+// OpInvoke has also second operand, the argument count and OpJumpTable
+// has its table
+func hasOperand(op uint8) bool {
+	switch op {
+	case OpConstant, OpBuildString, OpBuildList, OpExtendList, OpBuildMap, OpExtendMap, OpInvoke, OpCall, OpIndexIncrement,
+		OpGetLocal, OpDefineLocal, OpMatchList, OpJumpTable, OpGetGlobal, OpGetProperty:
+		return true
+	default:
+		return false
+	}
+}
+
+// isJump tells if the instruction has jump offset. OpTry has the offset
+// of its handler and then the offset of its finally block
+func isJump(op uint8) bool {
+	return op == OpJump || op == OpJumpIfFalse || op == OpTry
+}
+
+// instructionSize returns the size of the encoded instruction in bytes
+func instructionSize(op uint8) int {
+	switch {
+	case op == OpTry:
+		return 5
+	case isJump(op), op == OpInvoke:
+		return 3
+	case hasOperand(op):
+		return 2
+	default:
+		return 1
+	}
+}
+
+// usesConstant tells if the operand is index to the constant table
+func usesConstant(op uint8) bool {
+	switch op {
+	case OpConstant, OpInvoke, OpJumpTable, OpGetGlobal, OpGetProperty:
+		return true
+	default:
+		return false
+	}
+}
+
+func isBinaryOp(op uint8) bool {
+	switch op {
+	case OpEqual, OpNotEqual, OpGreater, OpLess, OpGreaterEqual, OpLessEqual,
+		OpAdd, OpSubtract, OpMultiply, OpDivide, OpIntDivide, OpModulo, OpPower,
+		OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft, OpShiftRight:
+		return true
+	default:
+		return false
+	}
+}
+
+// foldBinary calculates the result the same way as the VM does.
+// Returns false if the operation would be a runtime error
+func foldBinary(op uint8, a Value, b Value) (Value, bool) {
+	switch op {
+	case OpEqual:
+		return BoolVal(ValuesEqual(a, b)), true
+	case OpNotEqual:
+		return BoolVal(!ValuesEqual(a, b)), true
+	}
+
+	if op == OpAdd && IsString(a) && IsString(b) {
+		return StringVal(AsString(a) + AsString(b)), true
+	}
+
+	result, err := arithmetic(op, a, b)
+	return result, err == nil
+}
+
+// invertComparison returns the comparison that gives the negated result
+func invertComparison(op uint8) (uint8, bool) {
+	switch op {
+	case OpEqual:
+		return OpNotEqual, true
+	case OpNotEqual:
+		return OpEqual, true
+	case OpLess:
+		return OpGreaterEqual, true
+	case OpGreaterEqual:
+		return OpLess, true
+	case OpGreater:
+		return OpLessEqual, true
+	case OpLessEqual:
+		return OpGreater, true
+	default:
+		return 0, false
+	}
+}
+
+// producesBool tells if the instruction always leaves a boolean on the stack
+func producesBool(op uint8) bool {
+	switch op {
+	case OpTrue, OpFalse, OpNot, OpEqual, OpNotEqual, OpGreater, OpLess,
+		OpGreaterEqual, OpLessEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// producesFloat tells if the instruction always leaves a float on the
+// stack. Integers are left out, as negating the smallest one overflows
+func producesFloat(in instruction) bool {
+	return in.Op == OpConstant && IsNumber(in.Constant)
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+)
+
+// program is a test program and what it prints
+type program struct {
+	Source string
+	Output string
+}
+
+// optimizerPrograms exercise constant folding and the peephole rules
+var optimizerPrograms = []program{
+	{"1 + 2", "3\n"},
+	{"1 + 2 * 3 - 4", "3\n"},
+	{"(1 + 2) * (3 + 4)", "21\n"},
+	{"10.0 / 4", "2.5\n"},
+	{"1 / 2", "0.5\n"},
+	{"6 / 3", "2.0\n"},
+	{"1 / 0", "+Inf\n"},
+	{"7 ~/ 2 + -7 ~/ 2", "0\n"},
+	{"7.5 ~/ 2", "3.0\n"},
+	{"try { 1 ~/ 0 } catch (e) { e[\"message\"] }", "Division by zero.\n"},
+	{"(-9223372036854775807 - 1) ~/ -1", "Integer overflow.\n[line 1:28] in script\n"},
+	{"~// comment\n5", "-6\n"},
+	{"~/* comment */5", "-6\n"},
+	{"7 % 3 + 2 ** 10", "1025\n"},
+	{"1.5 * 2", "3.0\n"},
+	{"-(-3)", "3\n"},
+	{"!!true", "true\n"},
+	{"!!nil", "false\n"},
+	{"1 != 2", "true\n"},
+	{"1 >= 2", "false\n"},
+	{"2 <= 2", "true\n"},
+	{"!(1 < 2)", "false\n"},
+	{"1 == 1.0", "true\n"},
+	{"(1 | 6) ^ 3 << 1", "1\n"},
+	{"~5 & 0xff", "250\n"},
+	{"\"a\" + \"b\"", "ab\n"},
+	{"\"sum ${1 + 2}\"", "sum 3\n"},
+	{"[1 + 1, 2 * 2, \"x\"]", "[2, 4, \"x\"]\n"},
+	{"{\"a\": 1 + 1}[\"a\"]", "2\n"},
+	{"true ? 1 + 1 : 2 + 2", "2\n"},
+	{"nil ? 1 : 2", "2\n"},
+	{"match (3) { 1 => \"one\", 2..4 => \"some\", _ => \"many\" }", "some\n"},
+	{"match (5) { 1 => 1, 2 => 2, 3 => 3, 5 => 5, _ => 0 }", "5\n"},
+	{"match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }", "6\n"},
+	{"try { 1 / \"x\" } catch (e) { e[\"message\"] }", "Operands must be numbers.\n"},
+	{"try { throw 1 } catch (e) { e + 1 } finally { 0 }", "2\n"},
+	{"9223372036854775807 + 1", "Integer overflow.\n[line 1:21] in script\n"},
+}
+
+// runProgram compiles and runs the source with the current compiler
+// options. Returns what the program printed to stdout and stderr
+func runProgram(t *testing.T, source string) string {
+	return captureOutput(t, func() {
+		vm.Interpret(strings.NewReader(source))
+	})
+}
+
+// captureOutput calls run without debug output. Returns what it printed
+// to stdout and stderr
+func captureOutput(t *testing.T, run func()) string {
+	savedPrint, savedTrace := DebugPrintCode, DebugTraceExecution
+	DebugPrintCode, DebugTraceExecution = false, false
+	defer func() {
+		DebugPrintCode, DebugTraceExecution = savedPrint, savedTrace
+	}()
+
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	savedStdout, savedStderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = writer, writer
+
+	output := make(chan string)
+	go func() {
+		var buffer bytes.Buffer
+		io.Copy(&buffer, reader)
+		output <- buffer.String()
+	}()
+
+	run()
+
+	os.Stdout, os.Stderr = savedStdout, savedStderr
+	writer.Close()
+	return <-output
+}
+
+// runAtLevel runs the source at optimization level
+func runAtLevel(t *testing.T, source string, level int) string {
+	saved := OptimizationLevel
+	OptimizationLevel = level
+	defer func() { OptimizationLevel = saved }()
+
+	return runProgram(t, source)
+}
+
+func TestOptimizationLevelsGiveSameOutput(t *testing.T) {
+	for _, p := range optimizerPrograms {
+		unoptimized := runAtLevel(t, p.Source, 0)
+		optimized := runAtLevel(t, p.Source, 1)
+
+		if unoptimized != p.Output {
+			t.Errorf("%s at -O0 printed %q, want %q", p.Source, unoptimized, p.Output)
+		}
+		if optimized != unoptimized {
+			t.Errorf("%s printed %q at -O1 but %q at -O0", p.Source, optimized, unoptimized)
+		}
+	}
+}
+
+func TestFoldingAddsOnlyTheResult(t *testing.T) {
+	source := strings.Repeat("1 + ", 999) + "1"
+	chunk := compileChunk(t, source)
+
+	if chunk.Constants.Count != 1 || FormatValue(chunk.Constants.Values[0]) != "1000" {
+		constants := chunk.Constants.Values[:chunk.Constants.Count]
+		t.Errorf("1000 terms left constants %s", FormatValue(ListVal(constants)))
+	}
+}
+
+func TestFoldingTooManyConstants(t *testing.T) {
+	// Each item folds to a different constant, more than fit in the
+	// table, so the code is left unoptimized
+	items := []string{}
+	for i := 0; i < MaxConstants+10; i++ {
+		items = append(items, "1"+strings.Repeat(" + 1", i))
+	}
+	source := "[" + strings.Join(items, ", ") + "][-1]"
+
+	if output := runAtLevel(t, source, 1); output != "138\n" {
+		t.Errorf("%s printed %q", source, output)
+	}
+}
+
+func TestInterpretBytesChecksVersion(t *testing.T) {
+	chunk := compileChunk(t, "1")
+	chunk.Version = 0
+
+	var result int
+	output := captureOutput(t, func() { result = vm.InterpretBytes(chunk) })
+	if result != InterpretCompileError || !strings.Contains(output, "Compile it again") {
+		t.Errorf("old chunk returned %d and printed %q", result, output)
+	}
+}
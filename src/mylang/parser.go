@@ -0,0 +1,512 @@
+package main
+
+// parser.go turns tokens to syntax tree. Uses the same Parser state and
+// Precedence levels as the single pass compiler in compiler.go
+
+import (
+	"fmt"
+	"io"
+	"math"
+)
+
+// PrefixExprFn parses expression that starts with the previous token
+type PrefixExprFn func() Expr
+
+// InfixExprFn parses expression that continues from the left operand
+type InfixExprFn func(left Expr) Expr
+
+// ExprParseRule is used for expression rule table
+type ExprParseRule struct {
+	Prefix     PrefixExprFn
+	Infix      InfixExprFn
+	Precedence Precedence
+}
+
+// exprRules contains parsing rules for syntax tree. initialized in initParser()
+var exprRules = []ExprParseRule{}
+
+func parseExpr() Expr {
+	return parsePrecedenceExpr(PrecAssignment)
+}
+
+func parseBinaryExpr(left Expr) Expr {
+	operator := parser.Previous
+
+	// Parse the right operand. ** is right associative
+	rule := getExprRule(operator.Type)
+	precedence := rule.Precedence + 1
+	if operator.Type == TokenStarStar {
+		precedence = rule.Precedence
+	}
+	right := parsePrecedenceExpr(precedence)
+
+	return &BinaryExpr{left, operator, right}
+}
+
+func parseUnaryExpr() Expr {
+	operator := parser.Previous
+
+	// Parse the operand
+	operand := parsePrecedenceExpr(PrecUnary)
+
+	return &UnaryExpr{operator, operand}
+}
+
+func parseGroupingExpr() Expr {
+	paren := parser.Previous
+	expr := parseExpr()
+	consumeToken(TokenRightParen, "Expect ')' after expression")
+
+	return &GroupingExpr{paren, expr}
+}
+
+func parseLiteralExpr() Expr {
+	return &LiteralExpr{Token: parser.Previous}
+}
+
+func parseInterpolationExpr() Expr {
+	expr := &InterpolationExpr{Start: parser.Previous}
+
+	for {
+		expr.addStringPart()
+		expr.Parts = append(expr.Parts, parseExpr())
+
+		if parser.Current.Type != TokenInterpolation {
+			break
+		}
+		advanceParser()
+	}
+
+	consumeToken(TokenString, "Expect end of string after interpolation")
+	if parser.Previous.Type == TokenString {
+		expr.addStringPart()
+	}
+
+	return expr
+}
+
+func parseListExpr() Expr {
+	expr := &ListExpr{Bracket: parser.Previous}
+
+	for parser.Current.Type != TokenRightBracket {
+		expr.Items = append(expr.Items, parseExpr())
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBracket, "Expect ']' after list items")
+	return expr
+}
+
+// parseMapExpr parses map literal. There are no blocks in expressions
+// so '{' in prefix position is always a map
+func parseMapExpr() Expr {
+	expr := &MapExpr{Brace: parser.Previous}
+
+	for parser.Current.Type != TokenRightBrace {
+		expr.Keys = append(expr.Keys, parseExpr())
+		consumeToken(TokenColon, "Expect ':' after map key")
+		expr.Values = append(expr.Values, parseExpr())
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after map entries")
+	return expr
+}
+
+func parseIndexExpr(object Expr) Expr {
+	bracket := parser.Previous
+	canAssign := parser.CanAssign
+
+	index := parseExpr()
+	consumeToken(TokenRightBracket, "Expect ']' after index")
+
+	if canAssign && (parser.Current.Type == TokenEqual || isCompoundAssignment(parser.Current.Type)) {
+		advanceParser()
+		operator := parser.Previous
+		return &IndexSetExpr{object, bracket, index, operator, parseExpr()}
+	}
+
+	target := &IndexExpr{object, bracket, index}
+	if matchToken(TokenPlusPlus) || matchToken(TokenMinusMinus) {
+		return &IncrementExpr{parser.Previous, target, true}
+	}
+
+	return target
+}
+
+// parseIncrementExpr parses prefix ++list[index]. Postfix is parsed
+// by parseIndexExpr
+func parseIncrementExpr() Expr {
+	operator := parser.Previous
+	operand := parsePrecedenceExpr(PrecCall)
+
+	target, ok := operand.(*IndexExpr)
+	if ok {
+		return &IncrementExpr{operator, target, false}
+	}
+	if operator.Type != TokenMinusMinus {
+		errorAt(&operator, "Invalid increment target")
+		return operand
+	}
+
+	// --x is -(-x) when x isn't index
+	first, second := splitMinusMinus(operator)
+	return &UnaryExpr{first, &UnaryExpr{second, operand}}
+}
+
+// parseMinusMinusExpr parses a--b as a - -b. -- is decrement only next
+// to index
+func parseMinusMinusExpr(left Expr) Expr {
+	minus, negation := splitMinusMinus(parser.Previous)
+	right := parsePrefixedExpr(PrecFactor, func() Expr {
+		return &UnaryExpr{negation, parsePrecedenceExpr(PrecUnary)}
+	})
+
+	return &BinaryExpr{left, minus, right}
+}
+
+// splitMinusMinus returns the two '-' tokens of '--'
+func splitMinusMinus(token Token) (Token, Token) {
+	first := token
+	first.Type, first.Value, first.Length = TokenMinus, "-", 1
+
+	second := first
+	second.Column++
+	second.Offset++
+	return first, second
+}
+
+func parseTernaryExpr(condition Expr) Expr {
+	question := parser.Previous
+	then := parseExpr()
+
+	consumeToken(TokenColon, "Expect ':' after then branch of conditional expression")
+	colon := parser.Previous
+
+	// Right associative: a ? b : c ? d : e is a ? b : (c ? d : e)
+	return &ConditionalExpr{condition, question, then, colon, parsePrecedenceExpr(PrecTernary)}
+}
+
+func parseDotExpr(object Expr) Expr {
+	consumeToken(TokenIdentifier, "Expect property name after '.'")
+	name := parser.Previous
+
+	if !matchToken(TokenLeftParen) {
+		return &GetExpr{object, name}
+	}
+	return &InvokeExpr{object, name, parseArgumentsExpr()}
+}
+
+func parseCallExpr(callee Expr) Expr {
+	args := parseArgumentsExpr()
+	return &CallExpr{callee, parser.Previous, args}
+}
+
+func parseArgumentsExpr() []Expr {
+	args := []Expr{}
+
+	if parser.Current.Type != TokenRightParen {
+		for {
+			args = append(args, parseExpr())
+			if len(args) == math.MaxUint8+1 {
+				errorAtPrev("Can't have more than 255 arguments")
+			}
+
+			if !matchToken(TokenComma) {
+				break
+			}
+		}
+	}
+
+	consumeToken(TokenRightParen, "Expect ')' after arguments")
+	return args
+}
+
+func parseVariableExpr() Expr {
+	return &VariableExpr{Name: parser.Previous}
+}
+
+// parseMatchExpr parses match (subject) { pattern if guard => body, ... }
+func parseMatchExpr() Expr {
+	expr := &MatchExpr{Keyword: parser.Previous}
+	consumeToken(TokenLeftParen, "Expect '(' after 'match'")
+	expr.Subject = parseExpr()
+	consumeToken(TokenRightParen, "Expect ')' after match subject")
+
+	consumeToken(TokenLeftBrace, "Expect '{' before match arms")
+	for parser.Current.Type != TokenRightBrace {
+		arm := &MatchArm{Pattern: parsePatternExpr()}
+		if matchToken(TokenIf) {
+			arm.Guard = parseExpr()
+		}
+		consumeToken(TokenArrow, "Expect '=>' after match pattern")
+		arm.Arrow = parser.Previous
+		arm.Body = parseExpr()
+		expr.Arms = append(expr.Arms, arm)
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after match arms")
+	return expr
+}
+
+// parseTryExpr parses try { body } catch (name) { handler } finally
+// { cleanup }
+func parseTryExpr() Expr {
+	expr := &TryExpr{Keyword: parser.Previous}
+	expr.Body = parseBlockExpr("try")
+
+	hasCatch := matchToken(TokenCatch)
+	if hasCatch {
+		if matchToken(TokenLeftParen) {
+			consumeToken(TokenIdentifier, "Expect exception name after '('")
+			name := parser.Previous
+			expr.Name = &name
+			consumeToken(TokenRightParen, "Expect ')' after exception name")
+		}
+		expr.Handler = parseBlockExpr("catch")
+	}
+
+	if matchToken(TokenFinally) {
+		expr.Cleanup = parseBlockExpr("finally")
+	} else if !hasCatch {
+		errorAtCurrent("Expect 'catch' or 'finally' after try block")
+	}
+
+	return expr
+}
+
+// parseBlockExpr parses { expression } after the keyword
+func parseBlockExpr(keyword string) Expr {
+	consumeToken(TokenLeftBrace, fmt.Sprintf("Expect '{' after '%s'", keyword))
+	expr := parseExpr()
+	consumeToken(TokenRightBrace, fmt.Sprintf("Expect '}' after %s block", keyword))
+
+	return expr
+}
+
+func parseThrowExpr() Expr {
+	keyword := parser.Previous
+	return &ThrowExpr{keyword, parseExpr()}
+}
+
+func parsePatternExpr() Pattern {
+	switch {
+	case matchToken(TokenIdentifier):
+		return &BindingPattern{parser.Previous}
+	case matchToken(TokenLeftBracket):
+		return parseListPatternExpr()
+	case matchToken(TokenLeftBrace):
+		return parseMapPatternExpr()
+	}
+
+	low := parsePatternLiteralExpr()
+	if !matchToken(TokenDotDot) {
+		return low
+	}
+
+	high := parsePatternLiteralExpr()
+	if low.Token.Type != TokenNumber || high.Token.Type != TokenNumber {
+		errorAt(&low.Token, "Range pattern bounds must be numbers")
+	}
+	return &RangePattern{low, high}
+}
+
+// parsePatternLiteralExpr parses number, -number, string, true, false or nil
+func parsePatternLiteralExpr() *LiteralPattern {
+	if matchToken(TokenMinus) {
+		consumeToken(TokenNumber, "Expect number after '-' in pattern")
+		return &LiteralPattern{Token: parser.Previous, Negative: true}
+	}
+
+	if !isPatternLiteral(parser.Current.Type) {
+		errorAtCurrent("Expect pattern")
+		return &LiteralPattern{Token: parser.Current}
+	}
+	advanceParser()
+	return &LiteralPattern{Token: parser.Previous}
+}
+
+func parseListPatternExpr() Pattern {
+	pattern := &ListPattern{Bracket: parser.Previous}
+
+	for parser.Current.Type != TokenRightBracket {
+		if matchToken(TokenDotDot) {
+			pattern.Rest = true
+			break
+		}
+		pattern.Elements = append(pattern.Elements, parsePatternExpr())
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBracket, "Expect ']' after list pattern")
+	if len(pattern.Elements) > math.MaxInt8 {
+		errorAt(&pattern.Bracket, "Too many items in list pattern")
+	}
+
+	return pattern
+}
+
+// parseMapPatternExpr parses {key: pattern, ...}
+func parseMapPatternExpr() Pattern {
+	pattern := &MapPattern{Brace: parser.Previous}
+
+	for parser.Current.Type != TokenRightBrace {
+		pattern.Keys = append(pattern.Keys, parsePatternLiteralExpr())
+		consumeToken(TokenColon, "Expect ':' after map pattern key")
+		pattern.Values = append(pattern.Values, parsePatternExpr())
+
+		if !matchToken(TokenComma) {
+			break
+		}
+	}
+
+	consumeToken(TokenRightBrace, "Expect '}' after map pattern")
+	return pattern
+}
+
+// addStringPart adds the previous token as string part unless its empty
+func (expr *InterpolationExpr) addStringPart() {
+	if !emptyStringPart(&parser.Previous) {
+		expr.Parts = append(expr.Parts, &LiteralExpr{Token: parser.Previous})
+	}
+}
+
+func parsePrecedenceExpr(precedence Precedence) Expr {
+	advanceParser()
+	prefixRule := getExprRule(parser.Previous.Type).Prefix
+
+	if prefixRule == nil {
+		errorAtPrev("Expect expression")
+		return &LiteralExpr{Token: parser.Previous}
+	}
+
+	return parsePrefixedExpr(precedence, prefixRule)
+}
+
+// parsePrefixedExpr parses the expression that starts with prefixRule
+// and the infix operators of at least precedence after it
+func parsePrefixedExpr(precedence Precedence, prefixRule PrefixExprFn) Expr {
+	canAssign := precedence <= PrecAssignment
+	parser.CanAssign = canAssign
+	expr := prefixRule()
+
+	for precedence <= getExprRule(parser.Current.Type).Precedence {
+		advanceParser()
+		infixRule := getExprRule(parser.Previous.Type).Infix
+		parser.CanAssign = canAssign
+		expr = infixRule(expr)
+	}
+
+	if canAssign && (parser.Current.Type == TokenEqual || isCompoundAssignment(parser.Current.Type)) {
+		advanceParser()
+		errorAtPrev("Invalid assignment target")
+	}
+
+	return expr
+}
+
+func getExprRule(_type TokenType) *ExprParseRule {
+	return &exprRules[_type]
+}
+
+func initParser() {
+	// Init parse rule table
+	exprRules = []ExprParseRule{
+		{parseGroupingExpr, parseCallExpr, PrecCall},        // TokenLeftParen
+		{nil, nil, PrecNone},                                // TokenRightParen
+		{parseMapExpr, nil, PrecNone},                       // TokenLeftBrace
+		{nil, nil, PrecNone},                                // TokenRightBrace
+		{nil, nil, PrecNone},                                // TokenComma
+		{nil, parseDotExpr, PrecCall},                       // TokenDot
+		{parseUnaryExpr, parseBinaryExpr, PrecTerm},         // TokenMinus
+		{nil, parseBinaryExpr, PrecTerm},                    // TokenPlus
+		{nil, nil, PrecNone},                                // TokenSemicolon
+		{nil, parseBinaryExpr, PrecFactor},                  // TokenSlash
+		{nil, parseBinaryExpr, PrecFactor},                  // TokenStar
+		{parseUnaryExpr, nil, PrecNone},                     // TokenBang
+		{nil, parseBinaryExpr, PrecEquality},                // TokenBangEqual
+		{nil, nil, PrecNone},                                // TokenEqual
+		{nil, parseBinaryExpr, PrecEquality},                // TokenEqualEqual
+		{nil, parseBinaryExpr, PrecComparison},              // TokenGreater
+		{nil, parseBinaryExpr, PrecComparison},              // TokenGreaterEqual
+		{nil, parseBinaryExpr, PrecComparison},              // TokenLess
+		{nil, parseBinaryExpr, PrecComparison},              // TokenLessEqual
+		{parseVariableExpr, nil, PrecNone},                  // TokenIdentifier
+		{parseLiteralExpr, nil, PrecNone},                   // TokenString
+		{parseLiteralExpr, nil, PrecNone},                   // TokenNumber
+		{nil, nil, PrecAnd},                                 // TokenAnd
+		{nil, nil, PrecNone},                                // TokenClass
+		{nil, nil, PrecNone},                                // TokenElse
+		{parseLiteralExpr, nil, PrecNone},                   // TokenFalse
+		{nil, nil, PrecNone},                                // TokenFor
+		{nil, nil, PrecNone},                                // TokenFun
+		{nil, nil, PrecNone},                                // TokenIf
+		{parseLiteralExpr, nil, PrecNone},                   // TokenNil
+		{nil, nil, PrecNone},                                // TokenOr
+		{nil, nil, PrecNone},                                // TokenPrint
+		{nil, nil, PrecNone},                                // TokenReturn
+		{nil, nil, PrecNone},                                // TokenSuper
+		{nil, nil, PrecNone},                                // TokenThis
+		{parseLiteralExpr, nil, PrecNone},                   // TokenTrue
+		{nil, nil, PrecNone},                                // TokenVar
+		{nil, nil, PrecNone},                                // TokenWhile
+		{parseInterpolationExpr, nil, PrecNone},             // TokenInterpolation
+		{parseListExpr, parseIndexExpr, PrecCall},           // TokenLeftBracket
+		{nil, nil, PrecNone},                                // TokenRightBracket
+		{nil, nil, PrecNone},                                // TokenColon
+		{nil, parseBinaryExpr, PrecFactor},                  // TokenPercent
+		{nil, parseBinaryExpr, PrecPower},                   // TokenStarStar
+		{nil, parseBinaryExpr, PrecBitAnd},                  // TokenAmpersand
+		{nil, parseBinaryExpr, PrecBitOr},                   // TokenPipe
+		{nil, parseBinaryExpr, PrecBitXor},                  // TokenCaret
+		{parseUnaryExpr, nil, PrecNone},                     // TokenTilde
+		{nil, parseBinaryExpr, PrecShift},                   // TokenLessLess
+		{nil, parseBinaryExpr, PrecShift},                   // TokenGreaterGreater
+		{nil, nil, PrecNone},                                // TokenPlusEqual
+		{nil, nil, PrecNone},                                // TokenMinusEqual
+		{nil, nil, PrecNone},                                // TokenStarEqual
+		{nil, nil, PrecNone},                                // TokenSlashEqual
+		{nil, nil, PrecNone},                                // TokenPercentEqual
+		{parseIncrementExpr, nil, PrecNone},                 // TokenPlusPlus
+		{parseIncrementExpr, parseMinusMinusExpr, PrecTerm}, // TokenMinusMinus
+		{nil, parseTernaryExpr, PrecTernary},                // TokenQuestion
+		{nil, nil, PrecNone},                                // TokenDotDot
+		{nil, nil, PrecNone},                                // TokenArrow
+		{parseMatchExpr, nil, PrecNone},                     // TokenMatch
+		{parseTryExpr, nil, PrecNone},                       // TokenTry
+		{nil, nil, PrecNone},                                // TokenCatch
+		{nil, nil, PrecNone},                                // TokenFinally
+		{parseThrowExpr, nil, PrecNone},                     // TokenThrow
+		{nil, parseBinaryExpr, PrecFactor},                  // TokenTildeSlash
+		{nil, nil, PrecNone},                                // TokenError
+		{nil, nil, PrecNone},                                // TokenEOF
+	}
+}
+
+// Parse the source code to syntax tree
+func Parse(source io.Reader) (Expr, bool) {
+	initParser()
+	InitScanner(source)
+
+	parser.HadError = false
+	parser.PanicMode = false
+
+	advanceParser()
+	expr := parseExpr()
+
+	consumeToken(TokenEOF, "Expect end of expression")
+	return expr, !parser.HadError
+}
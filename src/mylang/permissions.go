@@ -0,0 +1,199 @@
+package main
+
+// permissions.go has the capabilities of scripts. Scripts can't touch
+// files unless the runner allows reading or writing the directories
+// they are in with --allow-read=dir and --allow-write=dir, and can't
+// read environment variables without --allow-env
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var errPermissionDenied = errors.New("permission denied")
+var errBrokenLink = errors.New("broken symbolic link")
+
+// Permissions are what scripts are allowed to do. Read and Write are
+// directories as absolute paths with symlinks resolved
+type Permissions struct {
+	Read  []string
+	Write []string
+	// Env lets scripts read environment variables
+	Env bool
+}
+
+// AllowRead lets scripts read the files under dir. Empty dir allows
+// reading everything
+func (p *Permissions) AllowRead(dir string) error {
+	resolved, err := resolveAllowed(dir)
+	if err != nil {
+		return err
+	}
+
+	p.Read = append(p.Read, resolved)
+	return nil
+}
+
+// AllowWrite lets scripts create and write the files under dir. Empty
+// dir allows writing everywhere
+func (p *Permissions) AllowWrite(dir string) error {
+	resolved, err := resolveAllowed(dir)
+	if err != nil {
+		return err
+	}
+
+	p.Write = append(p.Write, resolved)
+	return nil
+}
+
+// ParseFlag handles --allow-read[=dir], --allow-write[=dir] and
+// --allow-env. Returns false if the argument isn't permission flag
+func (p *Permissions) ParseFlag(arg string) (bool, error) {
+	name, dir := arg, ""
+	if i := strings.IndexByte(arg, '='); i >= 0 {
+		name, dir = arg[:i], arg[i+1:]
+	}
+
+	switch name {
+	case "--allow-read":
+		return true, p.AllowRead(dir)
+	case "--allow-write":
+		return true, p.AllowWrite(dir)
+	case "--allow-env":
+		if dir != "" {
+			return true, fmt.Errorf("--allow-env doesn't take a value")
+		}
+		p.Env = true
+		return true, nil
+	default:
+		return false, nil
+	}
+}
+
+// resolveAllowed resolves the allowed directory. The directory must
+// exist so that symlinks in it are resolved the same way as in paths
+func resolveAllowed(dir string) (string, error) {
+	if dir == "" {
+		return string(filepath.Separator), nil
+	}
+
+	resolved, err := filepath.Abs(dir)
+	if err == nil {
+		resolved, err = filepath.EvalSymlinks(resolved)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Can't allow '%s': %s", dir, pathErrorReason(err))
+	}
+	return resolved, nil
+}
+
+// resolvePath makes path absolute and resolves the symlinks in it so
+// that links can't lead out of the allowed directories. The file itself
+// doesn't need to exist as it may be created, but it can't be a broken
+// symlink as writing it would create the file the link points to
+func resolvePath(path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(absolute)
+	if err == nil {
+		return resolved, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	resolved, err = resolveLink(absolute)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Lstat(resolved); err == nil {
+		return "", errBrokenLink
+	}
+	return resolved, nil
+}
+
+// resolveLink resolves the symlinks in the directories of path but not
+// in the last name, so a symlink is the link and not the file it points to
+func resolveLink(path string) (string, error) {
+	absolute, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+
+	dir, err := filepath.EvalSymlinks(filepath.Dir(absolute))
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, filepath.Base(absolute)), nil
+}
+
+// isInside tells if the path is dir or under it
+func isInside(path string, dir string) bool {
+	relative, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+
+	parent := ".." + string(filepath.Separator)
+	return relative != ".." && !strings.HasPrefix(relative, parent)
+}
+
+// allowedPath resolves the path with resolve and returns
+// errPermissionDenied unless it's inside one of the allowed directories.
+// Paths that can't be resolved are checked as they are written, so
+// that the errors don't tell what is outside the allowed directories
+func allowedPath(path string, allowed []string, resolve func(string) (string, error)) (string, error) {
+	resolved, err := resolve(path)
+	checked := resolved
+	if err != nil {
+		checked, _ = filepath.Abs(path)
+	}
+
+	for _, dir := range allowed {
+		if isInside(checked, dir) {
+			return resolved, err
+		}
+	}
+	return "", errPermissionDenied
+}
+
+// checkAccess reports error unless the path is inside one of the
+// allowed directories. access is "read" or "write" and names the flag
+// in the error. Returns the resolved path
+func checkAccess(path string, allowed []string, access string) (string, bool) {
+	resolved, err := allowedPath(path, allowed, resolvePath)
+	return resolved, reportAccess(path, access, err)
+}
+
+// reportAccess reports the error of allowedPath. Returns false if
+// there was error
+func reportAccess(path string, access string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case err == errPermissionDenied:
+		runTimeError("Permission denied to %s '%s'. Allow it with --allow-%s.", access, path, access)
+	default:
+		runTimeError("Can't %s '%s': %s.", access, path, pathErrorReason(err))
+	}
+	return false
+}
+
+// pathErrorReason returns the reason of file error without the
+// operation and path
+func pathErrorReason(err error) error {
+	if pathErr, ok := err.(*os.PathError); ok {
+		return pathErr.Err
+	}
+	if linkErr, ok := err.(*os.LinkError); ok {
+		return linkErr.Err
+	}
+
+	return err
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// sandbox allows scripts to read and write only the returned directory.
+// outside is a directory next to it
+func sandbox(t *testing.T) (dir string, outside string) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, outside = filepath.Join(root, "sandbox"), filepath.Join(root, "outside")
+	for _, path := range []string{dir, outside} {
+		if err := os.Mkdir(path, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	saved := vm.Permissions
+	t.Cleanup(func() { vm.Permissions = saved })
+	vm.Permissions = Permissions{}
+	if err := vm.Permissions.AllowRead(dir); err != nil {
+		t.Fatal(err)
+	}
+	if err := vm.Permissions.AllowWrite(dir); err != nil {
+		t.Fatal(err)
+	}
+	return dir, outside
+}
+
+func TestWriteDoesNotFollowBrokenLink(t *testing.T) {
+	dir, outside := sandbox(t)
+	target := filepath.Join(outside, "created")
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "Can't write '" + link + "': broken symbolic link.\n[line 1:4] in script\n"
+	if output := runProgram(t, `fs.write("`+link+`", "x")`); output != want {
+		t.Errorf("fs.write printed %q, want %q", output, want)
+	}
+	if _, err := os.Lstat(target); err == nil {
+		t.Errorf("fs.write created %s through the link", target)
+	}
+}
+
+func TestRemoveRemovesLink(t *testing.T) {
+	dir, outside := sandbox(t)
+	target := filepath.Join(outside, "kept")
+	link := filepath.Join(dir, "link")
+	if err := os.WriteFile(target, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+
+	if output := runProgram(t, `fs.remove("`+link+`")`); output != "nil\n" {
+		t.Errorf("fs.remove printed %q", output)
+	}
+	if _, err := os.Lstat(link); err == nil {
+		t.Errorf("fs.remove didn't remove %s", link)
+	}
+	if _, err := os.Lstat(target); err != nil {
+		t.Errorf("fs.remove removed %s that the link points to", target)
+	}
+}
+
+func TestExists(t *testing.T) {
+	dir, outside := sandbox(t)
+	if err := os.Symlink(filepath.Join(outside, "missing"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	source := `[fs.exists("` + dir + `"), fs.exists("` + dir + `/missing/file"), fs.exists("` + dir + `/link")]`
+	if output := runProgram(t, source); output != "[true, false, false]\n" {
+		t.Errorf("%s printed %q", source, output)
+	}
+
+	missing := filepath.Join(outside, "missing", "file")
+	want := "Permission denied to read '" + missing + "'. Allow it with --allow-read.\n[line 1:4] in script\n"
+	if output := runProgram(t, `fs.exists("`+missing+`")`); output != want {
+		t.Errorf("fs.exists printed %q, want %q", output, want)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+// resolver.go walks the syntax tree before code generation.
+// It resolves the values of literals and reports the errors found
+
+import "math"
+
+// Resolve the syntax tree. Returns false if there were errors
+func Resolve(expr Expr) bool {
+	locals = Locals{}
+	resolveExpr(expr)
+	return !parser.HadError
+}
+
+func resolveExpr(expr Expr) {
+	switch expr := expr.(type) {
+	case *BinaryExpr:
+		resolveExpr(expr.Left)
+		resolveExpr(expr.Right)
+	case *UnaryExpr:
+		resolveExpr(expr.Operand)
+	case *GroupingExpr:
+		resolveExpr(expr.Expression)
+	case *InterpolationExpr:
+		for _, part := range expr.Parts {
+			resolveExpr(part)
+		}
+		if len(expr.Parts) > math.MaxUint8 {
+			errorAt(&expr.Start, "Too many parts in string interpolation")
+		}
+	case *LiteralExpr:
+		resolveLiteral(expr)
+	case *ListExpr:
+		for _, item := range expr.Items {
+			resolveExpr(item)
+		}
+	case *MapExpr:
+		for i := range expr.Keys {
+			resolveExpr(expr.Keys[i])
+			resolveExpr(expr.Values[i])
+		}
+	case *IndexExpr:
+		resolveExpr(expr.Object)
+		resolveExpr(expr.Index)
+	case *IndexSetExpr:
+		resolveExpr(expr.Object)
+		resolveExpr(expr.Index)
+		resolveExpr(expr.Value)
+	case *IncrementExpr:
+		resolveExpr(expr.Target)
+	case *ConditionalExpr:
+		resolveExpr(expr.Condition)
+		resolveExpr(expr.Then)
+		resolveExpr(expr.Else)
+	case *InvokeExpr:
+		resolveExpr(expr.Object)
+		for _, arg := range expr.Args {
+			resolveExpr(arg)
+		}
+	case *CallExpr:
+		resolveExpr(expr.Callee)
+		for _, arg := range expr.Args {
+			resolveExpr(arg)
+		}
+	case *GetExpr:
+		resolveExpr(expr.Object)
+	case *VariableExpr:
+		slot, ok := locals.lookup(&expr.Name)
+		if !ok {
+			checkGlobal(&expr.Name)
+		}
+		expr.Slot, expr.Global = slot, !ok
+	case *MatchExpr:
+		resolveMatch(expr)
+	case *TryExpr:
+		resolveTry(expr)
+	case *ThrowExpr:
+		resolveExpr(expr.Value)
+	}
+}
+
+// resolveMatch assigns the local slots in the same order as the single
+// pass compiler
+func resolveMatch(expr *MatchExpr) {
+	resolveExpr(expr.Subject)
+
+	saved := locals
+	expr.Slot = locals.addSlot(&expr.Keyword)
+	for _, arm := range expr.Arms {
+		armLocals := locals.beginArm()
+		resolvePattern(arm.Pattern, expr.Slot)
+		if arm.Guard != nil {
+			resolveExpr(arm.Guard)
+		}
+		resolveExpr(arm.Body)
+		locals = armLocals
+	}
+	locals = saved
+}
+
+// resolveTry gives slot to the exception name. It's only visible in
+// the catch block
+func resolveTry(expr *TryExpr) {
+	resolveExpr(expr.Body)
+
+	if expr.Handler != nil {
+		saved := locals.beginArm()
+		if expr.Name != nil {
+			expr.Slot = locals.addSlot(expr.Name)
+			locals.bind(expr.Name, expr.Slot)
+		}
+		resolveExpr(expr.Handler)
+		locals = saved
+	}
+
+	if expr.Cleanup != nil {
+		resolveExpr(expr.Cleanup)
+	}
+}
+
+// resolvePattern binds the names of pattern that matches the value
+// in slot
+func resolvePattern(pattern Pattern, slot int) {
+	switch pattern := pattern.(type) {
+	case *LiteralPattern:
+		pattern.Value = patternValue(&pattern.Token, pattern.Negative)
+	case *RangePattern:
+		resolvePattern(pattern.Low, slot)
+		resolvePattern(pattern.High, slot)
+	case *BindingPattern:
+		if !isWildcard(&pattern.Name) {
+			locals.bind(&pattern.Name, slot)
+		}
+	case *ListPattern:
+		pattern.Slots = make([]int, len(pattern.Elements))
+		for i, element := range pattern.Elements {
+			pattern.Slots[i] = resolveElement(element)
+		}
+	case *MapPattern:
+		pattern.Slots = make([]int, len(pattern.Values))
+		for i, value := range pattern.Values {
+			resolvePattern(pattern.Keys[i], slot)
+			pattern.Slots[i] = resolveElement(value)
+		}
+	}
+}
+
+// resolveElement gives slot to list element or map value pattern.
+// Returns -1 for _ as it isn't loaded
+func resolveElement(pattern Pattern) int {
+	if binding, ok := pattern.(*BindingPattern); ok && isWildcard(&binding.Name) {
+		return -1
+	}
+
+	token := pattern.Pos()
+	slot := locals.addSlot(&token)
+	resolvePattern(pattern, slot)
+	return slot
+}
+
+func resolveLiteral(expr *LiteralExpr) {
+	switch expr.Token.Type {
+	case TokenNumber:
+		expr.Value = numberLiteral(&expr.Token)
+	case TokenString, TokenInterpolation:
+		expr.Value = stringLiteral(&expr.Token)
+	case TokenTrue:
+		expr.Value = BoolVal(true)
+	case TokenFalse:
+		expr.Value = BoolVal(false)
+	case TokenNil:
+		expr.Value = NilVal()
+	}
+}
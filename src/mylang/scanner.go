@@ -1,39 +1,105 @@
 package main
 
-// FileEOF is constant for end of file
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// FileEOF is returned by peek when there are no more characters
 // use 0 instead of -1 to work with unsigned values
 const FileEOF = 0
 
-// Scanner is struct for scanning source code to tokens
+// readSize is how many bytes are read from the source at a time
+const readSize = 64 * 1024
+
+// Scanner is struct for scanning source code to tokens.
+// Source is read from Reader as the scanning goes. Source has the bytes
+// read so far, starting from Discarded bytes from the start of the source
 type Scanner struct {
-	Source   string
-	StartPos int
+	Reader    io.Reader
+	ReadError error
+	Source    []byte
+	Discarded int
+	StartPos  int
 
 	CurrentPos int
 	Line       int
+	// Column is the column of the next character counted in runes
+	Column int
+
+	// StartLine and StartColumn are the position of the token being scanned
+	StartLine   int
+	StartColumn int
+
+	// Doc has the /// comments on the lines right before the next token
+	Doc string
+
+	// Interpolations has a counter for each string interpolation we are in.
+	// Counter tells how many '{' are open inside the interpolation so
+	// we know which '}' continues the string
+	Interpolations []int
 }
 
 var scanner = Scanner{}
 
 // InitScanner initilizes the scanner for reading
-func InitScanner(source string) {
-	scanner.Source = source
+func InitScanner(source io.Reader) {
+	scanner.Reader = source
+	scanner.ReadError = nil
+	scanner.Source = nil
+	scanner.Discarded = 0
 	scanner.StartPos = 0
 	scanner.CurrentPos = 0
 	scanner.Line = 1
+	scanner.Column = 1
+	scanner.Doc = ""
+	scanner.Interpolations = nil
+
+	skipShebang()
+}
+
+// skipShebang skips #! line at the start of the source, so scripts can
+// be run directly with #!/usr/bin/env gloxrun
+func skipShebang() {
+	if !lookingAt("#!") {
+		return
+	}
+
+	for peek() != '\n' && !isAtEnd() {
+		advance()
+	}
 }
 
 // ScanToken returns the next token from source code
 func ScanToken() Token {
-	skipWhitespace()
+	if !skipWhitespace() {
+		return errorToken("Unterminated block comment.")
+	}
 
-	scanner.StartPos = scanner.CurrentPos
+	discardScanned()
+	markStart()
 
 	if isAtEnd() {
+		if scanner.ReadError != nil {
+			err := scanner.ReadError
+			scanner.ReadError = nil
+			return errorToken(fmt.Sprintf("Could not read source: %s", err))
+		}
 		return makeToken(TokenEOF)
 	}
 
 	c := advance()
+	if c == 'r' && peek() == '"' {
+		// Raw string r"..."
+		advance()
+		return stringStart(true)
+	}
+
 	if isAlpha(c) {
 		return identifier()
 	}
@@ -48,23 +114,84 @@ func ScanToken() Token {
 	case ')':
 		return makeToken(TokenRightParen)
 	case '{':
+		if depth := len(scanner.Interpolations); depth > 0 {
+			scanner.Interpolations[depth-1]++
+		}
 		return makeToken(TokenLeftBrace)
 	case '}':
+		if depth := len(scanner.Interpolations); depth > 0 {
+			if scanner.Interpolations[depth-1] == 0 {
+				// End of interpolation, continue the string
+				scanner.Interpolations = scanner.Interpolations[:depth-1]
+				return stringToken(false, false)
+			}
+			scanner.Interpolations[depth-1]--
+		}
 		return makeToken(TokenRightBrace)
+	case '[':
+		return makeToken(TokenLeftBracket)
+	case ']':
+		return makeToken(TokenRightBracket)
+	case ':':
+		return makeToken(TokenColon)
 	case ';':
 		return makeToken(TokenSemicolon)
 	case ',':
 		return makeToken(TokenComma)
 	case '.':
+		if match('.') {
+			return makeToken(TokenDotDot)
+		}
 		return makeToken(TokenDot)
 	case '-':
+		if match('-') {
+			return makeToken(TokenMinusMinus)
+		}
+		if match('=') {
+			return makeToken(TokenMinusEqual)
+		}
 		return makeToken(TokenMinus)
 	case '+':
+		if match('+') {
+			return makeToken(TokenPlusPlus)
+		}
+		if match('=') {
+			return makeToken(TokenPlusEqual)
+		}
 		return makeToken(TokenPlus)
 	case '/':
+		if match('=') {
+			return makeToken(TokenSlashEqual)
+		}
 		return makeToken(TokenSlash)
 	case '*':
+		if match('*') {
+			return makeToken(TokenStarStar)
+		}
+		if match('=') {
+			return makeToken(TokenStarEqual)
+		}
 		return makeToken(TokenStar)
+	case '%':
+		if match('=') {
+			return makeToken(TokenPercentEqual)
+		}
+		return makeToken(TokenPercent)
+	case '?':
+		return makeToken(TokenQuestion)
+	case '&':
+		return makeToken(TokenAmpersand)
+	case '|':
+		return makeToken(TokenPipe)
+	case '^':
+		return makeToken(TokenCaret)
+	case '~':
+		// ~// and ~/* are ~ and a comment
+		if peek() == '/' && peekNext() != '/' && peekNext() != '*' {
+			advance()
+			return makeToken(TokenTildeSlash)
+		}
+		return makeToken(TokenTilde)
 	case '!':
 		if match('=') {
 			return makeToken(TokenBangEqual)
@@ -74,63 +201,147 @@ func ScanToken() Token {
 		if match('=') {
 			return makeToken(TokenEqualEqual)
 		}
+		if match('>') {
+			return makeToken(TokenArrow)
+		}
 		return makeToken(TokenEqual)
 	case '<':
+		if match('<') {
+			return makeToken(TokenLessLess)
+		}
 		if match('=') {
 			return makeToken(TokenLessEqual)
 		}
 		return makeToken(TokenLess)
 	case '>':
+		if match('>') {
+			return makeToken(TokenGreaterGreater)
+		}
 		if match('=') {
 			return makeToken(TokenGreaterEqual)
 		}
 		return makeToken(TokenGreater)
 	case '"':
-		return stringToken()
+		return stringStart(false)
 
 	}
 
 	return errorToken("Unexpected character.")
 }
 
-func isAlpha(c uint8) bool {
+// markStart marks the current position as the start of the token
+func markStart() {
+	scanner.StartPos = scanner.CurrentPos
+	scanner.StartLine = scanner.Line
+	scanner.StartColumn = scanner.Column
+}
+
+// isAlpha checks if the character can start an identifier.
+// Identifiers can contain any Unicode letters
+func isAlpha(c rune) bool {
 	return (c >= 'a' && c <= 'z') ||
 		(c >= 'A' && c <= 'Z') ||
-		c == '_'
+		c == '_' ||
+		(c >= utf8.RuneSelf && unicode.IsLetter(c))
 }
 
-func isDigit(c uint8) bool {
+// isIdentifierPart checks if the character can continue an identifier.
+// Combining marks are allowed so that decomposed letters stay together
+func isIdentifierPart(c rune) bool {
+	return isAlpha(c) || isDigit(c) || (c >= utf8.RuneSelf && unicode.IsMark(c))
+}
+
+func isDigit(c rune) bool {
 	return c >= '0' && c <= '9'
 }
 
+// fill reads from the Reader until there are at least n bytes after
+// CurrentPos or the source ends
+func fill(n int) {
+	for scanner.Reader != nil && len(scanner.Source)-scanner.CurrentPos < n {
+		buffer := make([]byte, readSize)
+		count, err := scanner.Reader.Read(buffer)
+		scanner.Source = append(scanner.Source, buffer[:count]...)
+
+		if err != nil {
+			if err != io.EOF {
+				scanner.ReadError = err
+			}
+			scanner.Reader = nil
+		}
+	}
+}
+
+// discardScanned drops the bytes that are already scanned so that
+// large sources don't have to be kept in memory. Tokens have copies
+// of their values so they are not affected
+func discardScanned() {
+	if scanner.CurrentPos < readSize {
+		return
+	}
+
+	scanner.Discarded += scanner.CurrentPos
+	scanner.Source = append(scanner.Source[:0], scanner.Source[scanner.CurrentPos:]...)
+	scanner.StartPos = 0
+	scanner.CurrentPos = 0
+}
+
+// lookingAt checks if the source continues with text
+func lookingAt(text string) bool {
+	fill(len(text))
+	return bytes.HasPrefix(scanner.Source[scanner.CurrentPos:], []byte(text))
+}
+
+// offset converts position in Source to offset from the start of the source
+func offset(pos int) int {
+	return scanner.Discarded + pos
+}
+
 func isAtEnd() bool {
-	return scanner.Source[scanner.CurrentPos] == FileEOF
+	fill(1)
+	return scanner.CurrentPos >= len(scanner.Source)
 }
 
-func advance() uint8 {
-	scanner.CurrentPos++
-	return scanner.Source[scanner.CurrentPos-1]
+// advance consumes one UTF-8 encoded character.
+// Invalid bytes are returned one at a time as utf8.RuneError
+func advance() rune {
+	fill(utf8.UTFMax)
+	c, size := utf8.DecodeRune(scanner.Source[scanner.CurrentPos:])
+	scanner.CurrentPos += size
+	scanner.Column++
+	return c
 }
 
-func peek() uint8 {
-	return scanner.Source[scanner.CurrentPos]
+func peek() rune {
+	if isAtEnd() {
+		return FileEOF
+	}
+	fill(utf8.UTFMax)
+	c, _ := utf8.DecodeRune(scanner.Source[scanner.CurrentPos:])
+	return c
 }
 
-func peekNext() uint8 {
+func peekNext() rune {
 	if isAtEnd() {
 		return FileEOF
 	}
-	return scanner.Source[scanner.CurrentPos+1]
+	fill(2 * utf8.UTFMax)
+	_, size := utf8.DecodeRune(scanner.Source[scanner.CurrentPos:])
+	if scanner.CurrentPos+size >= len(scanner.Source) {
+		return FileEOF
+	}
+	c, _ := utf8.DecodeRune(scanner.Source[scanner.CurrentPos+size:])
+	return c
 }
 
-func match(expected uint8) bool {
+func match(expected rune) bool {
 	if isAtEnd() {
 		return false
 	}
-	if scanner.Source[scanner.CurrentPos] != expected {
+	if peek() != expected {
 		return false
 	}
-	scanner.CurrentPos++
+	advance()
 	return true
 }
 
@@ -138,46 +349,121 @@ func makeToken(_type TokenType) Token {
 	var token = Token{}
 	token.Type = _type
 	token.Length = scanner.CurrentPos - scanner.StartPos
-	token.Value = scanner.Source[scanner.StartPos:scanner.CurrentPos]
-	token.Line = scanner.Line
+	token.Value = string(scanner.Source[scanner.StartPos:scanner.CurrentPos])
+	token.Line = scanner.StartLine
+	token.Column = scanner.StartColumn
+	token.Offset = offset(scanner.StartPos)
+	token.Doc = scanner.Doc
+	scanner.Doc = ""
 
 	return token
 }
 
 func errorToken(message string) Token {
+	return errorTokenAt(message, scanner.StartLine, scanner.StartColumn, offset(scanner.StartPos))
+}
+
+// errorTokenAt creates error token that points to the given position
+// instead of the start of the token
+func errorTokenAt(message string, line int, column int, offset int) Token {
 	var token = Token{}
 	token.Type = TokenError
 	token.Value = message
 	token.Length = len(message)
-	token.Line = scanner.Line
+	token.Line = line
+	token.Column = column
+	token.Offset = offset
 
 	return token
 }
 
-func skipWhitespace() {
+// newline is called after consuming a '\n'
+func newline() {
+	scanner.Line++
+	scanner.Column = 1
+}
+
+// skipWhitespace skips whitespace and comments. Returns false if block
+// comment is not closed, the start of the comment is then marked as the
+// start of the token
+func skipWhitespace() bool {
+	// blank is true while the line has only whitespace. Doc comments
+	// must start their line and a blank line drops the doc before it
+	blank := scanner.Column == 1
+
 	for {
 		c := peek()
 
 		if c == ' ' || c == '\r' || c == '\t' {
 			advance()
 		} else if c == '\n' {
-			scanner.Line++
+			if blank {
+				scanner.Doc = ""
+			}
 			advance()
-		} else if c == '/' {
-			if peekNext() == '/' {
-				// A comment goes until the end of the line.
-				for peek() != '\n' && !isAtEnd() {
-					advance()
-				}
-				// Finally advance once more to consume the newline character
-				advance()
-			} else {
-				return
+			newline()
+			blank = true
+		} else if c == '/' && peekNext() == '/' {
+			lineComment(blank)
+			blank = false
+		} else if c == '/' && peekNext() == '*' {
+			if !blockComment() {
+				return false
 			}
+			blank = false
 		} else {
-			return
+			return true
+		}
+	}
+}
+
+// lineComment skips comment that goes until the end of the line.
+// Doc comments starting with /// are saved to scanner.Doc if the
+// comment starts the line
+func lineComment(doc bool) {
+	start := scanner.CurrentPos
+	for peek() != '\n' && !isAtEnd() {
+		advance()
+	}
+
+	comment := scanner.Source[start:scanner.CurrentPos]
+	if doc && bytes.HasPrefix(comment, []byte("///")) && !bytes.HasPrefix(comment, []byte("////")) {
+		text := string(bytes.TrimPrefix(comment[3:], []byte(" ")))
+		text = strings.TrimRight(text, "\r")
+		if scanner.Doc != "" {
+			scanner.Doc += "\n"
+		}
+		scanner.Doc += text
+	}
+}
+
+// blockComment skips /* */ comment. Block comments can be nested
+func blockComment() bool {
+	markStart()
+
+	// Consume the "/*"
+	advance()
+	advance()
+
+	depth := 1
+	for depth > 0 {
+		if isAtEnd() {
+			return false
+		}
+
+		c := advance()
+		if c == '\n' {
+			newline()
+		} else if c == '/' && peek() == '*' {
+			advance()
+			depth++
+		} else if c == '*' && peek() == '/' {
+			advance()
+			depth--
 		}
 	}
+
+	return true
 }
 
 func checkKeyword(start int, length int, rest string, _type TokenType) TokenType {
@@ -194,7 +480,15 @@ func identifierType() TokenType {
 	case 'a':
 		return checkKeyword(1, 2, "nd", TokenAnd)
 	case 'c':
-		return checkKeyword(1, 4, "lass", TokenClass)
+		if scanner.CurrentPos-scanner.StartPos > 1 {
+			switch scanner.Source[scanner.StartPos+1] {
+			case 'a':
+				return checkKeyword(2, 3, "tch", TokenCatch)
+			case 'l':
+				return checkKeyword(2, 3, "ass", TokenClass)
+			}
+		}
+		break
 	case 'e':
 		return checkKeyword(1, 3, "lse", TokenElse)
 	case 'f':
@@ -202,6 +496,8 @@ func identifierType() TokenType {
 			switch scanner.Source[scanner.StartPos+1] {
 			case 'a':
 				return checkKeyword(2, 3, "lse", TokenFalse)
+			case 'i':
+				return checkKeyword(2, 5, "nally", TokenFinally)
 			case 'o':
 				return checkKeyword(2, 1, "r", TokenFor)
 			case 'u':
@@ -211,6 +507,8 @@ func identifierType() TokenType {
 		break
 	case 'i':
 		return checkKeyword(1, 1, "f", TokenIf)
+	case 'm':
+		return checkKeyword(1, 4, "atch", TokenMatch)
 	case 'n':
 		return checkKeyword(1, 2, "il", TokenNil)
 	case 'o':
@@ -225,8 +523,14 @@ func identifierType() TokenType {
 		if scanner.CurrentPos-scanner.StartPos > 1 {
 			switch scanner.Source[scanner.StartPos+1] {
 			case 'h':
+				if scanner.CurrentPos-scanner.StartPos > 2 && scanner.Source[scanner.StartPos+2] == 'r' {
+					return checkKeyword(3, 2, "ow", TokenThrow)
+				}
 				return checkKeyword(2, 2, "is", TokenThis)
 			case 'r':
+				if scanner.CurrentPos-scanner.StartPos > 2 && scanner.Source[scanner.StartPos+2] == 'y' {
+					return checkKeyword(3, 0, "", TokenTry)
+				}
 				return checkKeyword(2, 2, "ue", TokenTrue)
 			}
 		}
@@ -241,42 +545,179 @@ func identifierType() TokenType {
 }
 
 func identifier() Token {
-	for isAlpha(peek()) || isDigit(peek()) {
+	for isIdentifierPart(peek()) {
 		advance()
 	}
 
 	return makeToken(identifierType())
 }
 
+// number scans number literal. Letters and digits right after the
+// number are made part of the token so that malformed literals like
+// 0b102 or 12abc are reported as one token by the compiler
 func number() Token {
-	for isDigit(peek()) {
+	if scanner.Source[scanner.StartPos] == '0' && isBasePrefix(peek()) {
+		// Consume the prefix and digits
+		advance()
+		for isIdentifierPart(peek()) {
+			advance()
+		}
+
+		return makeToken(TokenNumber)
+	}
+
+	for isDigit(peek()) || peek() == '_' {
 		advance()
 	}
 
 	if peek() == '.' && isDigit(peekNext()) {
 		// Consume the "."
 		advance()
-		for isDigit(peek()) {
+		for isDigit(peek()) || peek() == '_' {
 			advance()
 		}
 	}
 
+	if peek() == 'e' || peek() == 'E' {
+		// Consume the exponent and its sign
+		advance()
+		if peek() == '+' || peek() == '-' {
+			advance()
+		}
+	}
+
+	for isIdentifierPart(peek()) {
+		advance()
+	}
+
 	return makeToken(TokenNumber)
 }
 
-func stringToken() Token {
-	for peek() != '"' && !isAtEnd() {
-		if peek() == '\n' {
-			scanner.Line++
+func isBasePrefix(c rune) bool {
+	return c == 'x' || c == 'X' || c == 'b' || c == 'B' || c == 'o' || c == 'O'
+}
+
+// stringStart scans string literal after the opening '"' (and the 'r'
+// of raw string). String starting with three quotes ends with three quotes
+func stringStart(raw bool) Token {
+	triple := lookingAt(`""`)
+	if triple {
+		advance()
+		advance()
+	}
+
+	return stringToken(raw, triple)
+}
+
+// stringToken scans the rest of the string. Escapes are only checked here,
+// the compiler decodes them. In "..." strings '${' starts interpolation:
+// the part before it is returned as TokenInterpolation and the scanning
+// continues from the '}' that closes it
+func stringToken(raw bool, triple bool) Token {
+	// The first invalid escape is returned after the whole string is
+	// consumed, so scanning continues after the string
+	var escapeError *Token
+
+	for !isAtEnd() {
+		c := peek()
+		if c == '"' && (!triple || lookingAt(`"""`)) {
+			break
 		}
+
+		if c == '$' && peekNext() == '{' && !raw && !triple {
+			// Consume the '${'
+			advance()
+			advance()
+			scanner.Interpolations = append(scanner.Interpolations, 0)
+
+			if escapeError != nil {
+				return *escapeError
+			}
+			return makeToken(TokenInterpolation)
+		}
+
+		if c == '\\' && !raw {
+			line := scanner.Line
+			column := scanner.Column
+			escapeOffset := offset(scanner.CurrentPos)
+			message := escape()
+			if message != "" && escapeError == nil {
+				token := errorTokenAt(message, line, column, escapeOffset)
+				escapeError = &token
+			}
+			continue
+		}
+
 		advance()
+		if c == '\n' {
+			newline()
+		}
 	}
 
 	if isAtEnd() {
 		return errorToken("Unterminated string.")
 	}
 
-	// Consume the closing '"'
+	// Consume the closing quotes
 	advance()
+	if triple {
+		advance()
+		advance()
+	}
+
+	if escapeError != nil {
+		return *escapeError
+	}
+
 	return makeToken(TokenString)
 }
+
+// escape consumes the escape sequence starting with '\'.
+// Returns error message if the escape is invalid
+func escape() string {
+	// Consume the '\'
+	advance()
+
+	switch peek() {
+	case 'n', 't', 'r', '"', '\\', '$':
+		advance()
+		return ""
+	case 'u':
+		advance()
+		return unicodeEscape()
+	}
+
+	if isAtEnd() {
+		// Reported as unterminated string
+		return ""
+	}
+
+	// Leave the character to be scanned as part of the string
+	return "Invalid escape sequence."
+}
+
+// unicodeEscape consumes the {XXXX} part of \u{XXXX}
+func unicodeEscape() string {
+	if peek() != '{' {
+		return "Expect '{' after '\\u'."
+	}
+	advance()
+
+	start := scanner.CurrentPos
+	for isBaseDigit(peek(), 16) {
+		advance()
+	}
+	digits := string(scanner.Source[start:scanner.CurrentPos])
+
+	if peek() != '}' || len(digits) == 0 || len(digits) > 6 {
+		return "Invalid unicode escape."
+	}
+	advance()
+
+	codePoint, _ := strconv.ParseUint(digits, 16, 32)
+	if !validCodePoint(rune(codePoint)) {
+		return "Invalid unicode code point."
+	}
+
+	return ""
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+// scanTokens scans the whole source. Tokens are formatted as
+// "line:column TYPE 'value'" with the doc comment after them
+func scanTokens(source string) []string {
+	InitScanner(strings.NewReader(source))
+
+	tokens := []string{}
+	for {
+		token := ScanToken()
+		text := fmt.Sprintf("%d:%d %v '%s'", token.Line, token.Column, token.Type, token.Value)
+		if token.Doc != "" {
+			text += fmt.Sprintf(" doc %q", token.Doc)
+		}
+		tokens = append(tokens, text)
+
+		if token.Type == TokenEOF {
+			return tokens
+		}
+	}
+}
+
+// scannerTest is source and its tokens
+type scannerTest struct {
+	Source string
+	Tokens []string
+}
+
+func checkTokens(t *testing.T, tests []scannerTest) {
+	for _, test := range tests {
+		tokens := scanTokens(test.Source)
+		if strings.Join(tokens, "\n") != strings.Join(test.Tokens, "\n") {
+			t.Errorf("%q scanned to\n%s\nwant\n%s", test.Source,
+				strings.Join(tokens, "\n"), strings.Join(test.Tokens, "\n"))
+		}
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	checkTokens(t, []scannerTest{
+		{"/* a\n b */ 1", []string{"2:7 NUMBER '1'", "2:8 EOF ''"}},
+		{"/* \n\n */ x", []string{"3:5 IDENTIFIER 'x'", "3:6 EOF ''"}},
+		{"/* /* */ */ 1", []string{"1:13 NUMBER '1'", "1:14 EOF ''"}},
+		{"/**/1/***/", []string{"1:5 NUMBER '1'", "1:11 EOF ''"}},
+		{"1/**/2", []string{"1:1 NUMBER '1'", "1:6 NUMBER '2'", "1:7 EOF ''"}},
+		// Comments don't start inside strings and don't end outside them
+		{"\"/* s */\"", []string{"1:1 STRING '\"/* s */\"'", "1:10 EOF ''"}},
+		{"1 */ 2", []string{"1:1 NUMBER '1'", "1:3 STAR '*'", "1:4 SLASH '/'", "1:6 NUMBER '2'", "1:7 EOF ''"}},
+		// "/*/" doesn't close the comment it opens
+		{"/*/ 1", []string{"1:1 ERROR 'Unterminated block comment.'", "1:6 EOF ''"}},
+		{"/* /* */ 1", []string{"1:1 ERROR 'Unterminated block comment.'", "1:11 EOF ''"}},
+	})
+}
+
+func TestBlockCommentErrors(t *testing.T) {
+	checkCompileErrors(t, []errorProgram{
+		{Source: "1 /*", Output: "[line 1:3] Error: Unterminated block comment.\n"},
+		{Source: "\n  /* /* */\n", Output: "[line 2:3] Error: Unterminated block comment.\n"},
+		{Source: "/* a\n */ */ 1", Output: "[line 2:5] Error at '*': Expect expression\n"},
+	})
+}
+
+func TestTildeSlash(t *testing.T) {
+	checkTokens(t, []scannerTest{
+		{"7 ~/ 2", []string{"1:1 NUMBER '7'", "1:3 TILDE_SLASH '~/'", "1:6 NUMBER '2'", "1:7 EOF ''"}},
+		{"~// c\n5", []string{"1:1 TILDE '~'", "2:1 NUMBER '5'", "2:2 EOF ''"}},
+		{"~/*c*/5", []string{"1:1 TILDE '~'", "1:7 NUMBER '5'", "1:8 EOF ''"}},
+		{"~ /5", []string{"1:1 TILDE '~'", "1:3 SLASH '/'", "1:4 NUMBER '5'", "1:5 EOF ''"}},
+	})
+}
+
+func TestDocComments(t *testing.T) {
+	checkTokens(t, []scannerTest{
+		{"/// a\n///  b\n1", []string{"3:1 NUMBER '1' doc \"a\\n b\"", "3:2 EOF ''"}},
+		{"///a\r\n1", []string{"2:1 NUMBER '1' doc \"a\"", "2:2 EOF ''"}},
+		{"/// a\n/* x */ 1", []string{"2:9 NUMBER '1' doc \"a\"", "2:10 EOF ''"}},
+		{"  /// a\n  1", []string{"2:3 NUMBER '1' doc \"a\"", "2:4 EOF ''"}},
+		{"/// d\n[1,\n /// inner\n 2]", []string{"2:1 LEFT_BRACKET '[' doc \"d\"", "2:2 NUMBER '1'",
+			"2:3 COMMA ','", "4:2 NUMBER '2' doc \"inner\"", "4:3 RIGHT_BRACKET ']'", "4:4 EOF ''"}},
+		// Not doc comments
+		{"//// a\n// b\n1", []string{"3:1 NUMBER '1'", "3:2 EOF ''"}},
+		{"1 /// a\n2", []string{"1:1 NUMBER '1'", "2:1 NUMBER '2'", "2:2 EOF ''"}},
+		{"/* x */ /// a\n1", []string{"2:1 NUMBER '1'", "2:2 EOF ''"}},
+		// Blank line ends the doc comment
+		{"/// a\n\n1", []string{"3:1 NUMBER '1'", "3:2 EOF ''"}},
+		{"/// a\n  \n/// b\n1", []string{"4:1 NUMBER '1' doc \"b\"", "4:2 EOF ''"}},
+		{"/// a", []string{"1:6 EOF '' doc \"a\""}},
+	})
+}
+
+func TestNulBytes(t *testing.T) {
+	checkTokens(t, []scannerTest{
+		{"\"a\x00b\"", []string{"1:1 STRING '\"a\x00b\"'", "1:6 EOF ''"}},
+		{"r\"\x00\"", []string{"1:1 STRING 'r\"\x00\"'", "1:5 EOF ''"}},
+		{"// c\x00\n1", []string{"2:1 NUMBER '1'", "2:2 EOF ''"}},
+		{"/* \x00 */ 1", []string{"1:9 NUMBER '1'", "1:10 EOF ''"}},
+		// NUL doesn't end the source
+		{"1\x00 2", []string{"1:1 NUMBER '1'", "1:2 ERROR 'Unexpected character.'", "1:4 NUMBER '2'", "1:5 EOF ''"}},
+	})
+
+	if output := runProgram(t, "string.len(\"a\x00b\")"); output != "3\n" {
+		t.Errorf("string with NUL printed %q", output)
+	}
+	checkCompileErrors(t, []errorProgram{
+		{Source: "1 \x00", Output: "[line 1:3] Error: Unexpected character.\n"},
+	})
+}
+
+func TestScanOneByteAtATime(t *testing.T) {
+	source := "\"é${1 + 2}\" + r\"\"\"x\"\"\" /* a */ + \"\\u{41}\""
+
+	output := captureOutput(t, func() {
+		vm.Interpret(iotest.OneByteReader(strings.NewReader(source)))
+	})
+	if output != "é3xA\n" {
+		t.Errorf("%s printed %q", source, output)
+	}
+}
+
+func TestScanAcrossReadSize(t *testing.T) {
+	// Tokens that start before the end of the first read and end after
+	// it, and a string longer than the reads
+	for _, padding := range []int{readSize - 2, readSize - 1, readSize} {
+		source := strings.Repeat(" ", padding) + "string.len(\"ab\" + \"" + strings.Repeat("c", 2*readSize) + "\")"
+		want := fmt.Sprintf("%d\n", 2*readSize+2)
+		if output := runProgram(t, source); output != want {
+			t.Errorf("padding %d printed %q, want %q", padding, output, want)
+		}
+	}
+
+	// Positions count the discarded source
+	source := strings.Repeat("\n", readSize+1) + "  1 +\n" + strings.Repeat(" ", readSize) + "x"
+	want := fmt.Sprintf("[line %d:%d] Error at 'x': Undefined variable 'x'\n", readSize+3, readSize+1)
+	checkCompileErrors(t, []errorProgram{{Source: source, Output: want}})
+
+	expr, ok := Parse(strings.NewReader(strings.Repeat(" ", 2*readSize) + "-1"))
+	if !ok {
+		t.Fatal("-1 didn't parse")
+	}
+	node := NewASTNode(expr)
+	if node.Offset != 2*readSize || node.Operand.Offset != 2*readSize+1 {
+		t.Errorf("offsets are %d and %d", node.Offset, node.Operand.Offset)
+	}
+}
+
+func TestReadError(t *testing.T) {
+	source := io.MultiReader(strings.NewReader("1 +"), iotest.ErrReader(errors.New("disk gone")))
+	output := captureOutput(t, func() { vm.Interpret(source) })
+	if output != "[line 1:4] Error: Could not read source: disk gone\n" {
+		t.Errorf("read error printed %q", output)
+	}
+}
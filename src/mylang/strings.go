@@ -0,0 +1,154 @@
+package main
+
+// strings.go converts string literals to values.
+// "..." strings can contain escapes: \n \t \r \" \\ \$ and \u{XXXX},
+// and interpolations: "count: ${count}". The string parts around the
+// interpolated expressions are scanned as separate tokens.
+// r"..." raw strings are taken as they are written.
+// """...""" strings can span multiple lines and their common
+// indentation is removed. They can also be raw: r"""..."""
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+var errInvalidEscape = errors.New("Invalid escape sequence")
+
+// parseStringLiteral returns the contents of TokenString or TokenInterpolation
+func parseStringLiteral(text string) (string, error) {
+	raw := strings.HasPrefix(text, "r")
+	if raw {
+		text = text[1:]
+	}
+
+	var body string
+	if len(text) >= 6 && strings.HasPrefix(text, `"""`) {
+		body = stripIndent(text[3 : len(text)-3])
+	} else if strings.HasSuffix(text, "${") {
+		// Starts with '"' or with '}' if it follows another interpolation
+		body = text[1 : len(text)-2]
+	} else {
+		body = text[1 : len(text)-1]
+	}
+
+	if raw {
+		return body, nil
+	}
+
+	return decodeEscapes(body)
+}
+
+// decodeEscapes replaces the escape sequences with the characters
+func decodeEscapes(body string) (string, error) {
+	if !strings.Contains(body, `\`) {
+		return body, nil
+	}
+
+	var builder strings.Builder
+	for i := 0; i < len(body); i++ {
+		if body[i] != '\\' {
+			builder.WriteByte(body[i])
+			continue
+		}
+
+		i++
+		if i == len(body) {
+			return "", errInvalidEscape
+		}
+
+		switch body[i] {
+		case 'n':
+			builder.WriteByte('\n')
+		case 't':
+			builder.WriteByte('\t')
+		case 'r':
+			builder.WriteByte('\r')
+		case '"':
+			builder.WriteByte('"')
+		case '\\':
+			builder.WriteByte('\\')
+		case '$':
+			builder.WriteByte('$')
+		case 'u':
+			end := strings.IndexByte(body[i:], '}')
+			if end < 0 || !strings.HasPrefix(body[i:], "u{") {
+				return "", errInvalidEscape
+			}
+
+			codePoint, err := strconv.ParseUint(body[i+2:i+end], 16, 32)
+			if err != nil || !validCodePoint(rune(codePoint)) {
+				return "", errInvalidEscape
+			}
+
+			builder.WriteRune(rune(codePoint))
+			i += end
+		default:
+			return "", errInvalidEscape
+		}
+	}
+
+	return builder.String(), nil
+}
+
+// validCodePoint checks that \u{XXXX} escape can be encoded to UTF-8
+func validCodePoint(codePoint rune) bool {
+	return codePoint <= unicode.MaxRune && (codePoint < 0xD800 || codePoint > 0xDFFF)
+}
+
+// stripIndent removes the line break after the opening quotes, the last
+// line if it only has whitespace before the closing quotes, and the
+// indentation that is common to every line. Indentation of the closing
+// quotes counts, so text can be kept indented by moving the closing quotes
+// left
+func stripIndent(body string) string {
+	if !strings.Contains(body, "\n") {
+		return body
+	}
+
+	lines := strings.Split(body, "\n")
+
+	if len(lines) > 1 && isBlank(lines[0]) {
+		lines = lines[1:]
+	}
+
+	indent := -1
+	if len(lines) > 1 && isBlank(lines[len(lines)-1]) {
+		indent = len(lines[len(lines)-1])
+		lines = lines[:len(lines)-1]
+	}
+
+	for _, line := range lines {
+		if isBlank(line) {
+			continue
+		}
+
+		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+		if indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+
+	for i, line := range lines {
+		if isBlank(line) {
+			lines[i] = ""
+		} else if indent > 0 {
+			lines[i] = line[indent:]
+		}
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func isBlank(line string) bool {
+	return strings.TrimLeft(line, " \t\r") == ""
+}
+
+// emptyStringPart checks if the string part of interpolation has no
+// characters: "${, }${ or }"
+func emptyStringPart(token *Token) bool {
+	return (token.Type == TokenInterpolation && token.Length == 3) ||
+		(token.Type == TokenString && token.Value == `}"`)
+}
@@ -0,0 +1,96 @@
+package main
+
+import "testing"
+
+func TestDecodeEscapes(t *testing.T) {
+	tests := []struct {
+		Body  string
+		Value string
+	}{
+		{`plain`, "plain"},
+		{`a\nb\tc\rd`, "a\nb\tc\rd"},
+		{`\"\\\$`, "\"\\$"},
+		{`\u{41}\u{e9}\u{1F600}`, "Aé😀"},
+		{`\u{0}`, "\x00"},
+		{`\u{10FFFF}`, "\U0010FFFF"},
+	}
+
+	for _, test := range tests {
+		value, err := decodeEscapes(test.Body)
+		if err != nil {
+			t.Errorf("%s: %v", test.Body, err)
+		} else if value != test.Value {
+			t.Errorf("%s is %q, want %q", test.Body, value, test.Value)
+		}
+	}
+
+	for _, body := range []string{`\`, `\q`, `\u41`, `\u{}`, `\u{41`, `\u{xyz}`, `\u{D800}`, `\u{110000}`} {
+		if _, err := decodeEscapes(body); err != errInvalidEscape {
+			t.Errorf("%s: got error %v, want %v", body, err, errInvalidEscape)
+		}
+	}
+}
+
+func TestStripIndent(t *testing.T) {
+	tests := []struct {
+		Body  string
+		Value string
+	}{
+		{"one line", "one line"},
+		{"\n  a\n    b\n  ", "a\n  b"},
+		// Closing quotes left of the text keep the indentation
+		{"\n    a\n  ", "  a"},
+		// Blank lines don't count and lose their whitespace
+		{"\n  a\n \n  b\n  ", "a\n\nb"},
+		{"\n\ta\n\t\tb\n\t", "a\n\tb"},
+		// Text on the first and last line is kept
+		{"a\n  b", "a\n  b"},
+		{"\n  a\n  b", "a\nb"},
+	}
+
+	for _, test := range tests {
+		if value := stripIndent(test.Body); value != test.Value {
+			t.Errorf("%q is %q, want %q", test.Body, value, test.Value)
+		}
+	}
+}
+
+func TestStringLiteralErrors(t *testing.T) {
+	// Errors point at the '\' of the first invalid escape. Columns count
+	// runes
+	checkCompileErrors(t, []errorProgram{
+		{Source: `"ab\q"`, Output: "[line 1:4] Error: Invalid escape sequence.\n"},
+		{Source: `"a\qb\zc"`, Output: "[line 1:3] Error: Invalid escape sequence.\n"},
+		{Source: `"é\q"`, Output: "[line 1:3] Error: Invalid escape sequence.\n"},
+		{Source: "\"a\nb\\q\"", Output: "[line 2:2] Error: Invalid escape sequence.\n"},
+		{Source: `"\u41"`, Output: "[line 1:2] Error: Expect '{' after '\\u'.\n"},
+		{Source: `"\u{}"`, Output: "[line 1:2] Error: Invalid unicode escape.\n"},
+		{Source: `"\u{41"`, Output: "[line 1:2] Error: Invalid unicode escape.\n"},
+		{Source: `"\u{D800}"`, Output: "[line 1:2] Error: Invalid unicode code point.\n"},
+		{Source: `"\u{110000}"`, Output: "[line 1:2] Error: Invalid unicode code point.\n"},
+		// Escapes in the string parts around interpolations
+		{Source: `"x" + "\q${1}"`, Output: "[line 1:8] Error: Invalid escape sequence.\n"},
+		{Source: `"${1}\q"`, Output: "[line 1:6] Error: Invalid escape sequence.\n"},
+		{Source: "\"\"\"\n  \\q\"\"\"", Output: "[line 2:3] Error: Invalid escape sequence.\n"},
+		{Source: `"abc`, Output: "[line 1:1] Error: Unterminated string.\n"},
+		{Source: `"a\`, Output: "[line 1:1] Error: Unterminated string.\n"},
+		{Source: `r"a`, Output: "[line 1:1] Error: Unterminated string.\n"},
+		{Source: `"""a`, Output: "[line 1:1] Error: Unterminated string.\n"},
+		{Source: `"${1}`, Output: "[line 1:5] Error: Unterminated string.\n"},
+	})
+}
+
+func TestStringLiterals(t *testing.T) {
+	for _, p := range []program{
+		{`r"\q${1}"`, "\\q${1}\n"},
+		{"r\"\"\"\n  \\q\n  \"\"\"", "\\q\n"},
+		{`"""x"""`, "x\n"},
+		{`""""""`, "\n"},
+		{`"\u{1F600}"`, "😀\n"},
+		{`"$x \$"`, "$x $\n"},
+	} {
+		if output := runProgram(t, p.Source); output != p.Output {
+			t.Errorf("%s printed %q, want %q", p.Source, output, p.Output)
+		}
+	}
+}
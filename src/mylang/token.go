@@ -1,5 +1,7 @@
 package main
 
+import "fmt"
+
 // TokenType type for tokens
 type TokenType int
 
@@ -86,8 +88,66 @@ const (
 	// TokenWhile is type for while keyword
 	TokenWhile = 37
 
+	// TokenInterpolation is type for string part that ends in '${'
+	TokenInterpolation = 38
+
+	// TokenLeftBracket is type for '['
+	TokenLeftBracket = 39
+	// TokenRightBracket is type for ']'
+	TokenRightBracket = 40
+	// TokenColon is type for ':'
+	TokenColon = 41
+	// TokenPercent is type for '%'
+	TokenPercent = 42
+	// TokenStarStar is type for '**'
+	TokenStarStar = 43
+	// TokenAmpersand is type for '&'
+	TokenAmpersand = 44
+	// TokenPipe is type for '|'
+	TokenPipe = 45
+	// TokenCaret is type for '^'
+	TokenCaret = 46
+	// TokenTilde is type for '~'
+	TokenTilde = 47
+	// TokenLessLess is type for '<<'
+	TokenLessLess = 48
+	// TokenGreaterGreater is type for '>>'
+	TokenGreaterGreater = 49
+	// TokenPlusEqual is type for '+='
+	TokenPlusEqual = 50
+	// TokenMinusEqual is type for '-='
+	TokenMinusEqual = 51
+	// TokenStarEqual is type for '*='
+	TokenStarEqual = 52
+	// TokenSlashEqual is type for '/='
+	TokenSlashEqual = 53
+	// TokenPercentEqual is type for '%='
+	TokenPercentEqual = 54
+	// TokenPlusPlus is type for '++'
+	TokenPlusPlus = 55
+	// TokenMinusMinus is type for '--'
+	TokenMinusMinus = 56
+	// TokenQuestion is type for '?'
+	TokenQuestion = 57
+	// TokenDotDot is type for '..'
+	TokenDotDot = 58
+	// TokenArrow is type for '=>'
+	TokenArrow = 59
+	// TokenMatch is type for match keyword
+	TokenMatch = 60
+	// TokenTry is type for try keyword
+	TokenTry = 61
+	// TokenCatch is type for catch keyword
+	TokenCatch = 62
+	// TokenFinally is type for finally keyword
+	TokenFinally = 63
+	// TokenThrow is type for throw keyword
+	TokenThrow = 64
+	// TokenTildeSlash is type for '~/'
+	TokenTildeSlash = 65
+
 	// TokenError is type for error tokens
-	TokenError = 38
+	TokenError = 66
 
 	// TokenEOF is type for end of file token
 	TokenEOF = iota
@@ -99,4 +159,91 @@ type Token struct {
 	Value  string
 	Length int
 	Line   int
+	// Column is counted in characters, not bytes
+	Column int
+	// Offset is the byte offset in source
+	Offset int
+	// Doc has the /// doc comments written before the token
+	Doc string
+}
+
+// tokenNames has names of the token types for printing
+var tokenNames = [...]string{
+	TokenLeftParen:      "LEFT_PAREN",
+	TokenRightParen:     "RIGHT_PAREN",
+	TokenLeftBrace:      "LEFT_BRACE",
+	TokenRightBrace:     "RIGHT_BRACE",
+	TokenComma:          "COMMA",
+	TokenDot:            "DOT",
+	TokenMinus:          "MINUS",
+	TokenPlus:           "PLUS",
+	TokenSemicolon:      "SEMICOLON",
+	TokenSlash:          "SLASH",
+	TokenStar:           "STAR",
+	TokenBang:           "BANG",
+	TokenBangEqual:      "BANG_EQUAL",
+	TokenEqual:          "EQUAL",
+	TokenEqualEqual:     "EQUAL_EQUAL",
+	TokenGreater:        "GREATER",
+	TokenGreaterEqual:   "GREATER_EQUAL",
+	TokenLess:           "LESS",
+	TokenLessEqual:      "LESS_EQUAL",
+	TokenIdentifier:     "IDENTIFIER",
+	TokenString:         "STRING",
+	TokenNumber:         "NUMBER",
+	TokenAnd:            "AND",
+	TokenClass:          "CLASS",
+	TokenElse:           "ELSE",
+	TokenFalse:          "FALSE",
+	TokenFor:            "FOR",
+	TokenFun:            "FUN",
+	TokenIf:             "IF",
+	TokenNil:            "NIL",
+	TokenOr:             "OR",
+	TokenPrint:          "PRINT",
+	TokenReturn:         "RETURN",
+	TokenSuper:          "SUPER",
+	TokenThis:           "THIS",
+	TokenTrue:           "TRUE",
+	TokenVar:            "VAR",
+	TokenWhile:          "WHILE",
+	TokenInterpolation:  "INTERPOLATION",
+	TokenLeftBracket:    "LEFT_BRACKET",
+	TokenRightBracket:   "RIGHT_BRACKET",
+	TokenColon:          "COLON",
+	TokenPercent:        "PERCENT",
+	TokenStarStar:       "STAR_STAR",
+	TokenAmpersand:      "AMPERSAND",
+	TokenPipe:           "PIPE",
+	TokenCaret:          "CARET",
+	TokenTilde:          "TILDE",
+	TokenLessLess:       "LESS_LESS",
+	TokenGreaterGreater: "GREATER_GREATER",
+	TokenPlusEqual:      "PLUS_EQUAL",
+	TokenMinusEqual:     "MINUS_EQUAL",
+	TokenStarEqual:      "STAR_EQUAL",
+	TokenSlashEqual:     "SLASH_EQUAL",
+	TokenPercentEqual:   "PERCENT_EQUAL",
+	TokenPlusPlus:       "PLUS_PLUS",
+	TokenMinusMinus:     "MINUS_MINUS",
+	TokenQuestion:       "QUESTION",
+	TokenDotDot:         "DOT_DOT",
+	TokenArrow:          "ARROW",
+	TokenMatch:          "MATCH",
+	TokenTry:            "TRY",
+	TokenCatch:          "CATCH",
+	TokenFinally:        "FINALLY",
+	TokenThrow:          "THROW",
+	TokenTildeSlash:     "TILDE_SLASH",
+	TokenError:          "ERROR",
+	TokenEOF:            "EOF",
+}
+
+// String returns the name of the token type
+func (_type TokenType) String() string {
+	if _type >= 0 && int(_type) < len(tokenNames) {
+		return tokenNames[_type]
+	}
+
+	return fmt.Sprintf("TokenType(%d)", int(_type))
 }
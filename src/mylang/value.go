@@ -3,6 +3,9 @@ package main
 import (
 	"encoding/gob"
 	"fmt"
+	"math"
+	"strconv"
+	"strings"
 )
 
 // ValueType defines how the Value is handeled
@@ -13,8 +16,20 @@ const (
 	ValBool ValueType = iota
 	// ValNil is type for nil
 	ValNil ValueType = iota
-	// ValNumber is type for all number
+	// ValNumber is type for float numbers
 	ValNumber ValueType = iota
+	// ValString is type for strings
+	ValString ValueType = iota
+	// ValList is type for lists
+	ValList ValueType = iota
+	// ValMap is type for maps
+	ValMap ValueType = iota
+	// ValInt is type for 64-bit integers
+	ValInt ValueType = iota
+	// ValModule is type for built-in modules
+	ValModule ValueType = iota
+	// ValNative is type for built-in functions
+	ValNative ValueType = iota
 )
 
 // BoolValue is for true or false
@@ -32,6 +47,16 @@ type NumberValue struct {
 	Number float64
 }
 
+// IntValue is integer numbers in int64
+type IntValue struct {
+	Int int64
+}
+
+// StringValue is immutable string
+type StringValue struct {
+	Chars string
+}
+
 // Value is value for constants
 type Value struct {
 	Type ValueType
@@ -44,6 +69,8 @@ func RegisterValues() {
 	gob.Register(BoolValue{})
 	gob.Register(NilValue{})
 	gob.Register(NumberValue{})
+	gob.Register(IntValue{})
+	gob.Register(StringValue{})
 	gob.Register(Value{})
 }
 
@@ -62,6 +89,36 @@ func IsNumber(value Value) bool {
 	return value.Type == ValNumber
 }
 
+// IsInt checks if the value type is ValInt
+func IsInt(value Value) bool {
+	return value.Type == ValInt
+}
+
+// IsString checks if the value type is ValString
+func IsString(value Value) bool {
+	return value.Type == ValString
+}
+
+// IsList checks if the value type is ValList
+func IsList(value Value) bool {
+	return value.Type == ValList
+}
+
+// IsMap checks if the value type is ValMap
+func IsMap(value Value) bool {
+	return value.Type == ValMap
+}
+
+// IsModule checks if the value type is ValModule
+func IsModule(value Value) bool {
+	return value.Type == ValModule
+}
+
+// IsNative checks if the value type is ValNative
+func IsNative(value Value) bool {
+	return value.Type == ValNative
+}
+
 // AsBool gets the boolean from the value
 func AsBool(value Value) bool {
 	return value.As.(BoolValue).Boolean
@@ -73,6 +130,36 @@ func AsNumber(value Value) float64 {
 	return value.As.(NumberValue).Number
 }
 
+// AsInt gets the integer from the value
+func AsInt(value Value) int64 {
+	return value.As.(IntValue).Int
+}
+
+// AsString gets the string from the value
+func AsString(value Value) string {
+	return value.As.(StringValue).Chars
+}
+
+// AsList gets the list object from the value
+func AsList(value Value) *ListObject {
+	return value.As.(*ListObject)
+}
+
+// AsMap gets the map object from the value
+func AsMap(value Value) *MapObject {
+	return value.As.(*MapObject)
+}
+
+// AsModule gets the module object from the value
+func AsModule(value Value) *ModuleObject {
+	return value.As.(*ModuleObject)
+}
+
+// AsNative gets the native function from the value
+func AsNative(value Value) *NativeFunction {
+	return value.As.(*NativeFunction)
+}
+
 // BoolVal creates Value struct with ValBool type based on the value parameter
 func BoolVal(value bool) Value {
 	val := Value{}
@@ -101,6 +188,61 @@ func NumberVal(value float64) Value {
 
 }
 
+// IntVal creates Value struct with ValInt type based on the value parameter
+func IntVal(value int64) Value {
+	val := Value{}
+	val.Type = ValInt
+	val.As = IntValue{value}
+
+	return val
+}
+
+// StringVal creates Value struct with ValString type based on the value parameter
+func StringVal(value string) Value {
+	val := Value{}
+	val.Type = ValString
+	val.As = StringValue{value}
+
+	return val
+}
+
+// ListVal creates Value struct with ValList type that has a new list
+// with the items
+func ListVal(items []Value) Value {
+	val := Value{}
+	val.Type = ValList
+	val.As = &ListObject{items}
+
+	return val
+}
+
+// MapVal creates Value struct with ValMap type that has the map
+func MapVal(m *MapObject) Value {
+	val := Value{}
+	val.Type = ValMap
+	val.As = m
+
+	return val
+}
+
+// ModuleVal creates Value struct with ValModule type that has the module
+func ModuleVal(module *ModuleObject) Value {
+	val := Value{}
+	val.Type = ValModule
+	val.As = module
+
+	return val
+}
+
+// NativeVal creates Value struct with ValNative type that has the function
+func NativeVal(function *NativeFunction) Value {
+	val := Value{}
+	val.Type = ValNative
+	val.As = function
+
+	return val
+}
+
 // ValueArray holds values
 type ValueArray struct {
 	Capacity int
@@ -109,8 +251,21 @@ type ValueArray struct {
 }
 
 // ValuesEqual cheks if values equal
-// Equality between different types is always false
+// Equality between different types is always false, except that
+// integers and floats are compared as numbers so 1 == 1.0.
+// Lists are equal if they have equal items and maps if they have
+// the same keys with equal values
 func ValuesEqual(a Value, b Value) bool {
+	return valuesEqual(a, b, map[[2]interface{}]bool{})
+}
+
+// valuesEqual compares values. compared has the lists and maps that are
+// already being compared so the ones that contain themselves don't loop
+// forever
+func valuesEqual(a Value, b Value, compared map[[2]interface{}]bool) bool {
+	if isNumeric(a) && isNumeric(b) && a.Type != b.Type {
+		return toFloat(a) == toFloat(b)
+	}
 	if a.Type != b.Type {
 		return false
 	}
@@ -122,12 +277,59 @@ func ValuesEqual(a Value, b Value) bool {
 		return true
 	case ValNumber:
 		return AsNumber(a) == AsNumber(b)
+	case ValInt:
+		return AsInt(a) == AsInt(b)
+	case ValString:
+		return AsString(a) == AsString(b)
+	case ValList:
+		return listsEqual(AsList(a), AsList(b), compared)
+	case ValMap:
+		return mapsEqual(AsMap(a), AsMap(b), compared)
+	case ValModule:
+		return AsModule(a) == AsModule(b)
+	case ValNative:
+		return AsNative(a) == AsNative(b)
 
 	default:
 		return false
 	}
 }
 
+func listsEqual(a *ListObject, b *ListObject, compared map[[2]interface{}]bool) bool {
+	pair := [2]interface{}{a, b}
+	if a == b || compared[pair] {
+		return true
+	}
+	if len(a.Items) != len(b.Items) {
+		return false
+	}
+
+	compared[pair] = true
+	for i := range a.Items {
+		if !valuesEqual(a.Items[i], b.Items[i], compared) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// SameConstant checks if values can share the same slot in constant pool
+// Numbers are compared by their bit pattern so 0 and -0 are kept apart
+// and NaN can be shared
+func SameConstant(a Value, b Value) bool {
+	if a.Type != b.Type {
+		return false
+	}
+
+	switch a.Type {
+	case ValNumber:
+		return math.Float64bits(AsNumber(a)) == math.Float64bits(AsNumber(b))
+	default:
+		return ValuesEqual(a, b)
+	}
+}
+
 // InitValueArray initializes the Value array
 func (array *ValueArray) InitValueArray() {
 	array.Values = nil
@@ -157,17 +359,80 @@ func (array *ValueArray) Reallocate(oldSize int) {
 
 // PrintValue prints the value
 func PrintValue(value Value) {
+	fmt.Printf("%s", FormatValue(value))
+}
+
+// FormatValue converts the value to string the way it's printed
+func FormatValue(value Value) string {
+	return formatValue(value, map[interface{}]bool{})
+}
+
+// formatValue converts the value to string. printing has the lists and
+// maps that are being printed, so list that contains itself is printed
+// as [...] and map as {...}
+func formatValue(value Value, printing map[interface{}]bool) string {
 	switch value.Type {
 	case ValBool:
-		if AsBool(value) {
-			fmt.Printf("true")
-		} else {
-			fmt.Printf("false")
-
-		}
+		return strconv.FormatBool(AsBool(value))
 	case ValNil:
-		fmt.Printf("nil")
+		return "nil"
 	case ValNumber:
-		fmt.Printf("%g", AsNumber(value))
+		return formatFloat(AsNumber(value))
+	case ValInt:
+		return strconv.FormatInt(AsInt(value), 10)
+	case ValString:
+		return AsString(value)
+	case ValList:
+		return formatList(AsList(value), printing)
+	case ValMap:
+		return formatMap(AsMap(value), printing)
+	case ValModule:
+		return "<module " + AsModule(value).Name + ">"
+	case ValNative:
+		return "<native " + AsNative(value).Name + ">"
+	default:
+		return ""
+	}
+}
+
+// formatFloat prints floats in the shortest form that reads back to the
+// same number. Integral floats get ".0" so they can be told apart from
+// integers. Very large and small numbers use exponent
+func formatFloat(number float64) string {
+	switch {
+	case math.IsNaN(number) || math.IsInf(number, 0):
+		return fmt.Sprintf("%g", number)
+	case number != 0 && (math.Abs(number) >= 1e21 || math.Abs(number) < 1e-6):
+		return strconv.FormatFloat(number, 'g', -1, 64)
 	}
+
+	text := strconv.FormatFloat(number, 'f', -1, 64)
+	if !strings.Contains(text, ".") {
+		text += ".0"
+	}
+	return text
+}
+
+func formatList(list *ListObject, printing map[interface{}]bool) string {
+	if printing[list] {
+		return "[...]"
+	}
+	printing[list] = true
+	defer delete(printing, list)
+
+	items := make([]string, len(list.Items))
+	for i, item := range list.Items {
+		items[i] = formatItem(item, printing)
+	}
+
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// formatItem formats value inside a collection. Strings are quoted
+func formatItem(value Value, printing map[interface{}]bool) string {
+	if IsString(value) {
+		return strconv.Quote(AsString(value))
+	}
+
+	return formatValue(value, printing)
 }
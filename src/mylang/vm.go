@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"io"
+	"math"
 	"os"
+	"strings"
 )
 
 // RunTimeError tells if vm has encountered an error
@@ -18,30 +21,44 @@ const (
 	InterpretCompileError = iota
 	// InterpretRuntimeError is returned when running the bytecode failed
 	InterpretRuntimeError = iota
+	// InterpretExit is returned when the program called exit. The code
+	// is in vm.ExitCode
+	InterpretExit = iota
 )
 
 // VM is virtual mashine that runs the bytecode
 type VM struct {
 	Chunk    Chunk
-	IP       uint8
+	IP       int
 	IPArr    []uint8
 	Stack    [StackMax]Value
 	StackTop Value
 	// StackPos keeps track of the stack position
 	StackPos int
+	// Locals has the values of match subjects and pattern bindings
+	Locals [StackMax]Value
+	// Handlers are the active exception handlers, innermost last
+	Handlers []Handler
+	// Exception is the error object of the last runtime error
+	Exception Value
+	// Trace is the stack trace of the exception being thrown
+	Trace []Value
+	// Permissions are what the fs and env modules can use
+	Permissions Permissions
+	// Exiting is set while exit runs the finally blocks before stopping
+	// the program with ExitCode
+	Exiting  bool
+	ExitCode int
 }
 
 func (vm *VM) resetStack() {
 	vm.StackTop = vm.Stack[vm.StackPos]
 }
 
-func runTimeError(format string, args ...string) {
-	fmt.Fprintf(os.Stderr, format)
-	fmt.Fprintf(os.Stderr, "\n")
-
-	fmt.Fprintf(os.Stderr, "[line %d] in script\n",
-		vm.Chunk.Lines[vm.IP])
-
+// runTimeError creates the error object for the error. The run loop
+// throws it after the instruction sets RunTimeError
+func runTimeError(format string, args ...interface{}) {
+	vm.Exception = newErrorObject(fmt.Sprintf(format, args...), vm.stackTrace())
 }
 
 // InitVM initializes the virtual mashine
@@ -54,8 +71,14 @@ func (vm *VM) FreeVM() {
 	//TODO:
 }
 
-// Push Value to stack
+// Push Value to stack. Reports runtime error if the stack is full
 func (vm *VM) Push(value Value) {
+	if vm.StackPos == StackMax {
+		runTimeError("Stack overflow.")
+		RunTimeError = true
+		return
+	}
+
 	vm.Stack[vm.StackPos] = value
 	vm.StackPos++
 }
@@ -81,36 +104,295 @@ func (vm *VM) readByte() uint8 {
 }
 
 func (vm *VM) binaryOp(op uint8) {
+	result, err := arithmetic(op, vm.peekStack(1), vm.peekStack(0))
+	if err != nil {
+		runTimeError("%s", err)
+		RunTimeError = true
+		return
+	}
+
+	vm.StackPos -= 2
+	vm.Push(result)
+}
+
+func (vm *VM) concatenate() {
+	b := AsString(vm.Pop())
+	a := AsString(vm.Pop())
+	vm.Push(StringVal(a + b))
+}
+
+func (vm *VM) buildString(count int) {
+	var builder strings.Builder
+	for i := count - 1; i >= 0; i-- {
+		builder.WriteString(FormatValue(vm.peekStack(i)))
+	}
+
+	vm.StackPos -= count
+	vm.Push(StringVal(builder.String()))
+}
+
+func (vm *VM) buildList(count int) {
+	items := make([]Value, count)
+	copy(items, vm.Stack[vm.StackPos-count:vm.StackPos])
+
+	vm.StackPos -= count
+	vm.Push(ListVal(items))
+}
+
+// extendList appends count values on the stack to the list under them
+func (vm *VM) extendList(count int) {
+	list := AsList(vm.Stack[vm.StackPos-count-1])
+	list.Items = append(list.Items, vm.Stack[vm.StackPos-count:vm.StackPos]...)
+
+	vm.StackPos -= count
+}
+
+// buildMap creates map from count key and value pairs on the stack
+func (vm *VM) buildMap(count int) {
+	m := NewMapObject()
+	if !vm.setEntries(m, count) {
+		return
+	}
+
+	vm.Push(MapVal(m))
+}
+
+// extendMap sets count key and value pairs on the stack to the map
+// under them
+func (vm *VM) extendMap(count int) {
+	vm.setEntries(AsMap(vm.Stack[vm.StackPos-2*count-1]), count)
+}
+
+// setEntries pops count key and value pairs and sets them to the map
+func (vm *VM) setEntries(m *MapObject, count int) bool {
+	for i := vm.StackPos - 2*count; i < vm.StackPos; i += 2 {
+		if !m.Set(vm.Stack[i], vm.Stack[i+1]) {
+			RunTimeError = true
+			return false
+		}
+	}
+
+	vm.StackPos -= 2 * count
+	return true
+}
+
+func (vm *VM) indexGet() {
+	var value Value
+	var ok bool
+
+	switch object := vm.peekStack(1); {
+	case IsList(object):
+		value, ok = AsList(object).IndexGet(vm.peekStack(0))
+	case IsMap(object):
+		value, ok = AsMap(object).IndexGet(vm.peekStack(0))
+	default:
+		runTimeError("Only lists and maps can be indexed.")
+	}
+
+	if !ok {
+		RunTimeError = true
+		return
+	}
+	vm.StackPos -= 2
+	vm.Push(value)
+}
+
+func (vm *VM) indexSet() {
+	value := vm.peekStack(0)
+	ok := false
+
+	switch object := vm.peekStack(2); {
+	case IsList(object):
+		ok = AsList(object).IndexSet(vm.peekStack(1), value)
+	case IsMap(object):
+		ok = AsMap(object).IndexSet(vm.peekStack(1), value)
+	default:
+		runTimeError("Only lists and maps can be indexed.")
+	}
+
+	if !ok {
+		RunTimeError = true
+		return
+	}
+
+	vm.StackPos -= 3
+	// Assignment is an expression that has the assigned value
+	vm.Push(value)
+}
+
+// indexIncrement adds or subtracts 1 from list[index] or map[key]
+func (vm *VM) indexIncrement(flags uint8) {
+	var old Value
+	var ok bool
+
+	object := vm.peekStack(1)
+	index := vm.peekStack(0)
+	switch {
+	case IsList(object):
+		old, ok = AsList(object).IndexGet(index)
+	case IsMap(object):
+		old, ok = AsMap(object).IndexGet(index)
+	default:
+		runTimeError("Only lists and maps can be indexed.")
+	}
+	if !ok {
+		RunTimeError = true
+		return
+	}
+
+	if !isNumeric(old) {
+		runTimeError("%s", errOperandNumber)
+		RunTimeError = true
+		return
+	}
+
+	op := OpAdd
+	if flags&IncrementDecrement != 0 {
+		op = OpSubtract
+	}
+	result, err := arithmetic(op, old, IntVal(1))
+	if err != nil {
+		runTimeError("%s", err)
+		RunTimeError = true
+		return
+	}
+
+	if IsList(object) {
+		AsList(object).IndexSet(index, result)
+	} else {
+		AsMap(object).IndexSet(index, result)
+	}
+
+	vm.StackPos -= 2
+	if flags&IncrementPostfix != 0 {
+		vm.Push(old)
+	} else {
+		vm.Push(result)
+	}
+}
+
+// invoke calls the method of the receiver that is below the arguments
+func (vm *VM) invoke(name string, argCount int) {
+	receiver := vm.peekStack(argCount)
+
+	var method NativeMethod
+	switch {
+	case IsList(receiver):
+		method = listMethods[name]
+	case IsMap(receiver):
+		method = mapMethods[name]
+	case IsModule(receiver):
+		method = AsModule(receiver).Functions[name]
+	}
+
+	if method == nil {
+		runTimeError("Undefined method '%s'.", name)
+		RunTimeError = true
+		return
+	}
+
+	vm.callNative(method, receiver, argCount)
+}
+
+// call calls the function below the arguments
+func (vm *VM) call(argCount int) {
+	callee := vm.peekStack(argCount)
+	if !IsNative(callee) {
+		runTimeError("Can only call functions.")
+		RunTimeError = true
+		return
+	}
+
+	vm.callNative(AsNative(callee).Function, callee, argCount)
+}
+
+// callNative calls the Go function with the arguments on the stack and
+// replaces the receiver and the arguments with the result
+func (vm *VM) callNative(method NativeMethod, receiver Value, argCount int) {
+	args := make([]Value, argCount)
+	copy(args, vm.Stack[vm.StackPos-argCount:vm.StackPos])
 
-	if !IsNumber(vm.peekStack(0)) || !IsNumber(vm.peekStack(1)) {
-		runTimeError("Operands must be numbers.")
+	result, ok := method(receiver, args)
+	if !ok {
 		RunTimeError = true
 		return
 	}
 
-	b := AsNumber(vm.Pop())
-	a := AsNumber(vm.Pop())
+	vm.StackPos -= argCount + 1
+	vm.Push(result)
+}
+
+// matchList tells if the value is list of the length in flags. The
+// list can be longer with MatchListRest
+func matchList(value Value, flags uint8) bool {
+	if !IsList(value) {
+		return false
+	}
+
+	length := len(AsList(value).Items)
+	count := int(flags &^ MatchListRest)
+	if flags&MatchListRest != 0 {
+		return length >= count
+	}
+	return length == count
+}
+
+// inRange tells if low <= value <= high. Values that aren't numbers
+// are not in range
+func inRange(value Value, low Value, high Value) bool {
+	if !isNumeric(value) || (IsNumber(value) && math.IsNaN(AsNumber(value))) {
+		return false
+	}
+
+	above, _ := arithmetic(OpGreaterEqual, value, low)
+	below, _ := arithmetic(OpLessEqual, value, high)
+	return AsBool(above) && AsBool(below)
+}
+
+// tableIndex returns the position of the value in the jump table that
+// starts from low. Floats that equal an integer are looked up too,
+// as 1 == 1.0
+func tableIndex(value Value, low int64, count int) (int, bool) {
+	var number int64
+	switch {
+	case IsInt(value):
+		number = AsInt(value)
+	case IsNumber(value):
+		float := AsNumber(value)
+		if float != math.Trunc(float) || float < math.MinInt64 || float >= math.MaxInt64 {
+			return 0, false
+		}
+		number = int64(float)
+	default:
+		return 0, false
+	}
+
+	if number < low || uint64(number)-uint64(low) >= uint64(count) {
+		return 0, false
+	}
+	return int(number - low), true
+}
+
+// jumpTable jumps to the table address of the popped value or to the
+// default address
+func (vm *VM) jumpTable() {
+	low := AsInt(vm.readConstant())
+	count := int(vm.readByte())
+	table := vm.IP
 
-	switch op {
-	case '<':
-		vm.Push(BoolVal(a < b))
-		break
-	case '>':
-		vm.Push(BoolVal(a > b))
-		break
-	case '+':
-		vm.Push(NumberVal(a + b))
-		break
-	case '-':
-		vm.Push(NumberVal(a - b))
-		break
-	case '*':
-		vm.Push(NumberVal(a * b))
-		break
-	case '/':
-		vm.Push(NumberVal(a / b))
-		break
+	entry := 0
+	if index, ok := tableIndex(vm.Pop(), low, count); ok {
+		entry = 1 + index
 	}
+
+	vm.IP = table + 2*entry
+	vm.IP = vm.readShort()
+}
+
+// readShort reads two byte big endian operand
+func (vm *VM) readShort() int {
+	high := int(vm.readByte())
+	return high<<8 | int(vm.readByte())
 }
 
 func (vm *VM) readConstant() Value {
@@ -120,16 +402,18 @@ func (vm *VM) readConstant() Value {
 // run is where the actual bytecode is executed
 func (vm *VM) run() int {
 	for {
-		fmt.Printf("          ")
-		for i := 0; i < int(vm.StackPos); i++ {
-			if vm.Stack[i].As != nil {
-				fmt.Printf("[ ")
-				PrintValue(vm.Stack[i])
-				fmt.Printf(" ]")
+		if DebugTraceExecution {
+			fmt.Printf("          ")
+			for i := 0; i < int(vm.StackPos); i++ {
+				if vm.Stack[i].As != nil {
+					fmt.Printf("[ ")
+					PrintValue(vm.Stack[i])
+					fmt.Printf(" ]")
+				}
 			}
+			fmt.Printf("\n")
+			vm.Chunk.DisassembleInstruction(vm.IP)
 		}
-		fmt.Printf("\n")
-		vm.Chunk.DisassembleInstruction(int(vm.IP))
 
 		instruction := vm.readByte()
 		switch instruction {
@@ -155,32 +439,188 @@ func (vm *VM) run() int {
 				vm.Push(BoolVal(ValuesEqual(a, b)))
 				break
 			}
+		case OpNotEqual:
+			{
+				b := vm.Pop()
+				a := vm.Pop()
+				vm.Push(BoolVal(!ValuesEqual(a, b)))
+				break
+			}
 		case OpGreater:
-			vm.binaryOp('>')
+			vm.binaryOp(OpGreater)
 			break
 		case OpLess:
-			vm.binaryOp('<')
+			vm.binaryOp(OpLess)
+			break
+		case OpGreaterEqual:
+			vm.binaryOp(OpGreaterEqual)
+			break
+		case OpLessEqual:
+			vm.binaryOp(OpLessEqual)
 			break
 		case OpAdd:
-			vm.binaryOp('+')
+			if IsString(vm.peekStack(0)) && IsString(vm.peekStack(1)) {
+				vm.concatenate()
+			} else {
+				vm.binaryOp(OpAdd)
+			}
 			break
 		case OpSubtract:
-			vm.binaryOp('-')
+			vm.binaryOp(OpSubtract)
 			break
 		case OpMultiply:
-			vm.binaryOp('*')
+			vm.binaryOp(OpMultiply)
 			break
 		case OpDivide:
-			vm.binaryOp('/')
+			vm.binaryOp(OpDivide)
+			break
+		case OpIntDivide, OpModulo, OpPower, OpBitAnd, OpBitOr, OpBitXor, OpShiftLeft, OpShiftRight:
+			vm.binaryOp(instruction)
 			break
 		case OpNot:
 			vm.Push(BoolVal(isFalsey(vm.Pop())))
-		case OpNegate:
-			if !IsNumber(vm.peekStack(0)) {
-				runTimeError("Operand must be a number.")
-				RunTimeError = true
+		case OpNegate, OpBitNot:
+			{
+				result, err := unaryArithmetic(instruction, vm.peekStack(0))
+				if err != nil {
+					runTimeError("%s", err)
+					RunTimeError = true
+					break
+				}
+				vm.Pop()
+				vm.Push(result)
+				break
+			}
+		case OpBuildString:
+			vm.buildString(int(vm.readByte()))
+			break
+		case OpBuildList:
+			vm.buildList(int(vm.readByte()))
+			break
+		case OpExtendList:
+			vm.extendList(int(vm.readByte()))
+			break
+		case OpBuildMap:
+			vm.buildMap(int(vm.readByte()))
+			break
+		case OpExtendMap:
+			vm.extendMap(int(vm.readByte()))
+			break
+		case OpIndexGet:
+			vm.indexGet()
+			break
+		case OpIndexSet:
+			vm.indexSet()
+			break
+		case OpIndexIncrement:
+			vm.indexIncrement(vm.readByte())
+			break
+		case OpPop:
+			vm.Pop()
+			break
+		case OpDup2:
+			vm.Push(vm.peekStack(1))
+			vm.Push(vm.peekStack(1))
+			break
+		case OpJump:
+			{
+				offset := vm.readShort()
+				vm.IP += offset
+				break
+			}
+		case OpJumpIfFalse:
+			{
+				offset := vm.readShort()
+				if isFalsey(vm.peekStack(0)) {
+					vm.IP += offset
+				}
+				break
+			}
+		case OpInvoke:
+			{
+				name := AsString(vm.readConstant())
+				vm.invoke(name, int(vm.readByte()))
+				break
+			}
+		case OpCall:
+			vm.call(int(vm.readByte()))
+			break
+		case OpGetLocal:
+			vm.Push(vm.Locals[vm.readByte()])
+			break
+		case OpGetGlobal:
+			// Compilers only emit names that are defined
+			vm.Push(builtins[AsString(vm.readConstant())])
+			break
+		case OpGetProperty:
+			{
+				name := AsString(vm.readConstant())
+				value, ok := getProperty(vm.Pop(), name)
+				if !ok {
+					RunTimeError = true
+					break
+				}
+				vm.Push(value)
+				break
+			}
+		case OpDefineLocal:
+			vm.Locals[vm.readByte()] = vm.Pop()
+			break
+		case OpMatchList:
+			vm.Push(BoolVal(matchList(vm.Pop(), vm.readByte())))
+			break
+		case OpMatchMap:
+			vm.Push(BoolVal(IsMap(vm.Pop())))
+			break
+		case OpInRange:
+			{
+				high := vm.Pop()
+				low := vm.Pop()
+				vm.Push(BoolVal(inRange(vm.Pop(), low, high)))
+				break
+			}
+		case OpJumpTable:
+			vm.jumpTable()
+			break
+		case OpNoMatch:
+			runTimeError("No match arm for %s.", formatItem(vm.Pop(), map[interface{}]bool{}))
+			RunTimeError = true
+			break
+		case OpTry:
+			{
+				offset := vm.readShort()
+				target := vm.IP + offset
+				offset = vm.readShort()
+				finally := -1
+				if offset != 0 {
+					finally = vm.IP + offset
+				}
+				// The handler needs room for the exception
+				if vm.StackPos == StackMax {
+					runTimeError("Stack overflow.")
+					RunTimeError = true
+					break
+				}
+				vm.Handlers = append(vm.Handlers, Handler{target, finally, vm.StackPos})
+				break
+			}
+		case OpEndTry:
+			vm.Handlers = vm.Handlers[:len(vm.Handlers)-1]
+			break
+		case OpThrow:
+			if !vm.throwValue(vm.Pop()) {
+				return vm.uncaught()
+			}
+			break
+		case OpRethrow:
+			if !vm.throw(vm.Pop(), vm.Trace) {
+				return vm.uncaught()
+			}
+			break
+		case OpEndFinally:
+			if AsBool(vm.Pop()) && !vm.throw(vm.Pop(), vm.Trace) {
+				return vm.uncaught()
 			}
-			vm.Push(NumberVal(-AsNumber(vm.Pop())))
 			break
 		case OpReturn:
 			PrintValue(vm.Pop())
@@ -192,21 +632,34 @@ func (vm *VM) run() int {
 		}
 
 		if RunTimeError {
-			return InterpretRuntimeError
+			RunTimeError = false
+			_, trace, _ := errorObjectFields(vm.Exception)
+			if !vm.throw(vm.Exception, trace) {
+				return vm.uncaught()
+			}
 		}
 	}
 }
 
 // InterpretBytes feeds the chunk that we get from glb file
 func (vm *VM) InterpretBytes(chunk Chunk) int {
+	if chunk.Version != ChunkVersion {
+		fmt.Fprintf(os.Stderr, "Bytecode was compiled by another version of gloxc. Compile it again.\n")
+		return InterpretCompileError
+	}
+
 	vm.Chunk = chunk
 	vm.IP = 0
 	vm.IPArr = vm.Chunk.Code
+	// A runtime error leaves its values on the stack
+	vm.StackPos = 0
+	vm.Handlers = nil
+	vm.Exiting = false
 	return vm.run()
 }
 
-// Interpret from source string
-func (vm *VM) Interpret(source string) int {
+// Interpret from source reader
+func (vm *VM) Interpret(source io.Reader) int {
 	var chunk = Chunk{}
 	chunk.InitChunk()
 	if !Compile(source, &chunk) {
@@ -216,5 +669,9 @@ func (vm *VM) Interpret(source string) int {
 	vm.Chunk = chunk
 	vm.IP = 0
 	vm.IPArr = vm.Chunk.Code
+	// A runtime error leaves its values on the stack
+	vm.StackPos = 0
+	vm.Handlers = nil
+	vm.Exiting = false
 	return vm.run()
 }